@@ -0,0 +1,419 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	proxyPkg "golem/proxy"
+	serverPkg "golem/server"
+)
+
+// executeTimeout is the timeout of console commands.
+const executeTimeout = 30 * time.Second
+
+// Timeouts of connections, where writing responses waits for stops, which
+// can take minutes.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 5 * time.Minute
+)
+
+// An API is the HTTP admin API of golem, authenticated with a bearer token.
+//
+//	GET    /servers                  servers
+//	GET    /servers/{name}           server with players
+//	POST   /servers/{name}/start     start
+//	POST   /servers/{name}/stop      stop, waiting until stopped
+//	POST   /servers/{name}/restart   stop if not stopped, then start
+//	DELETE /servers/{name}/idle      cancel the stop timer
+//	POST   /servers/{name}/idle      extend the stop timer by {"extend": "5m"}
+//	POST   /servers/{name}/execute   execute {"command": "list"}
+//	POST   /reload                   reload the config, then list servers
+type API struct {
+	logger *log.Logger
+	token  string
+	routes func() map[string]*proxyPkg.Route // by server name
+	reload func() error
+}
+
+// A server is a server in responses.
+type server struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Uptime   int64      `json:"uptime"` // in seconds
+	Players  int        `json:"players"`
+	StopTime *time.Time `json:"stopTime"` // of the stop timer, if running
+}
+
+// A serverDetails is a server with its players in responses.
+type serverDetails struct {
+	server
+	PlayerList []player `json:"playerList"`
+}
+
+// A player is a connected player in responses.
+type player struct {
+	Name    string    `json:"name"`
+	UUID    string    `json:"uuid"`
+	Addr    string    `json:"addr"`
+	Since   time.Time `json:"since"`
+	Session int64     `json:"session"` // in seconds
+}
+
+// An httpError is an error with an HTTP status code.
+type httpError struct {
+	code int
+	err  error
+}
+
+// Error implements error.
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+// NewAPI returns a new API serving the routes returned by a function, which
+// change when the config is reloaded by another function.
+func NewAPI(
+	logger *log.Logger,
+	token string,
+	routes func() map[string]*proxyPkg.Route,
+	reload func() error,
+) *API {
+	a := API{}
+	a.logger = logger
+	a.token = token
+	a.routes = routes
+	a.reload = reload
+	return &a
+}
+
+// ListenAndServe listens on a TCP address and serves the API.
+func (a *API) ListenAndServe(addr string) error {
+
+	server := http.Server{
+		Addr:              addr,
+		Handler:           a,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		ErrorLog:          a.logger,
+	}
+
+	a.logger.Printf("listening on %s\n", addr)
+	return server.ListenAndServe()
+
+}
+
+// ServeHTTP implements http.Handler, writing JSON responses, and errors as
+// {"error": "..."}.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	response, err := a.handle(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		var httpErr httpError
+		if errors.As(err, &httpErr) {
+			code = httpErr.code
+		}
+		if code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		w.WriteHeader(code)
+		response = map[string]string{"error": err.Error()}
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.logger.Printf("error writing response: %s\n", err)
+	}
+
+}
+
+// handle handles a request, returning the response.
+func (a *API) handle(r *http.Request) (interface{}, error) {
+
+	// Check token
+	header := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return nil, httpError{http.StatusUnauthorized, errors.New("bad token")}
+	}
+
+	// Path is /reload or /servers[/name[/action]]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] == "reload" && len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			return nil, errMethod
+		}
+		return a.reloadConfig()
+	}
+	if parts[0] != "servers" || len(parts) > 3 {
+		return nil, httpError{http.StatusNotFound, errors.New("not found")}
+	}
+	routes := a.routes()
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			return nil, errMethod
+		}
+		return a.servers(routes), nil
+	}
+	name := parts[1]
+	route, ok := routes[name]
+	if !ok {
+		err := fmt.Errorf("unknown server %q", name)
+		return nil, httpError{http.StatusNotFound, err}
+	}
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		return a.server(name, route), nil
+	case action == "start" && r.Method == http.MethodPost:
+		return a.start(name, route)
+	case action == "stop" && r.Method == http.MethodPost:
+		return a.stop(name, route)
+	case action == "restart" && r.Method == http.MethodPost:
+		return a.restart(name, route)
+	case action == "idle" && r.Method == http.MethodDelete:
+		return a.cancelIdle(name, route)
+	case action == "idle" && r.Method == http.MethodPost:
+		return a.extendIdle(name, route, r)
+	case action == "execute" && r.Method == http.MethodPost:
+		return a.execute(route, r)
+	case actions[action]:
+		return nil, errMethod
+	}
+	return nil, httpError{http.StatusNotFound, errors.New("not found")}
+
+}
+
+// actions are the actions on a server, where empty gets the server.
+var actions = map[string]bool{
+	"":        true,
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"idle":    true,
+	"execute": true,
+}
+
+// errMethod is returned for methods not allowed on a path.
+var errMethod = httpError{
+	http.StatusMethodNotAllowed,
+	errors.New("method not allowed"),
+}
+
+// reloadConfig reloads the config, returning the servers of the new config,
+// or the reload error as a bad request.
+func (a *API) reloadConfig() ([]server, error) {
+
+	a.logger.Println("reloading config")
+	err := a.reload()
+	if err != nil {
+		a.logger.Printf("error reloading config: %s\n", err)
+		return nil, httpError{http.StatusBadRequest, err}
+	}
+	return a.servers(a.routes()), nil
+
+}
+
+// servers returns all servers sorted by name.
+func (a *API) servers(routes map[string]*proxyPkg.Route) []server {
+	servers := []server{}
+	for name, route := range routes {
+		servers = append(servers, newServer(name, route))
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+	return servers
+}
+
+// server returns a server with its players.
+func (a *API) server(name string, route *proxyPkg.Route) serverDetails {
+	details := serverDetails{server: newServer(name, route)}
+	details.PlayerList = []player{}
+	for _, p := range route.Players() {
+		details.PlayerList = append(details.PlayerList, player{
+			Name:    p.Name,
+			UUID:    p.UUID,
+			Addr:    p.Addr,
+			Since:   p.Since,
+			Session: int64(time.Since(p.Since).Seconds()),
+		})
+	}
+	return details
+}
+
+// start starts a server, which stops again if nobody joins.
+func (a *API) start(name string, route *proxyPkg.Route) (server, error) {
+
+	a.logger.Printf("starting server %s\n", name)
+	err := route.Server().Start()
+	if err != nil {
+		return server{}, stateError(err)
+	}
+	route.Idle()
+	return newServer(name, route), nil
+
+}
+
+// stop stops a server, waiting until it is stopped.
+func (a *API) stop(name string, route *proxyPkg.Route) (server, error) {
+
+	a.logger.Printf("stopping server %s\n", name)
+	route.CancelStopTimer()
+	err := route.Server().Stop()
+	if err != nil {
+		return server{}, stateError(err)
+	}
+	return newServer(name, route), nil
+
+}
+
+// restart stops a server if it is not stopped, then starts it.
+func (a *API) restart(name string, route *proxyPkg.Route) (server, error) {
+
+	a.logger.Printf("restarting server %s\n", name)
+	route.CancelStopTimer()
+	err := route.Server().Stop()
+	if err != nil && !errors.Is(err, serverPkg.ErrStopped) {
+		return server{}, stateError(err)
+	}
+	return a.start(name, route)
+
+}
+
+// cancelIdle cancels the stop timer of a server.
+func (a *API) cancelIdle(name string, route *proxyPkg.Route) (server, error) {
+	if !route.CancelStopTimer() {
+		return server{}, errNoTimer
+	}
+	a.logger.Printf("canceled stop timer of server %s\n", name)
+	return newServer(name, route), nil
+}
+
+// extendIdle delays the stop timer of a server by the duration in the
+// request.
+func (a *API) extendIdle(
+	name string,
+	route *proxyPkg.Route,
+	r *http.Request,
+) (server, error) {
+
+	var request struct {
+		Extend string `json:"extend"`
+	}
+	err := decode(r, &request)
+	if err != nil {
+		return server{}, err
+	}
+	d, err := time.ParseDuration(request.Extend)
+	if err != nil || d <= 0 {
+		err := fmt.Errorf("extend: invalid duration %q", request.Extend)
+		return server{}, httpError{http.StatusBadRequest, err}
+	}
+
+	_, ok := route.ExtendStopTimer(d)
+	if !ok {
+		return server{}, errNoTimer
+	}
+	a.logger.Printf("extended stop timer of server %s by %s\n", name, d)
+	return newServer(name, route), nil
+
+}
+
+// errNoTimer is returned for stop timers that are not running.
+var errNoTimer = httpError{
+	http.StatusConflict,
+	errors.New("stop timer not running"),
+}
+
+// execute executes the command in the request on a server.
+func (a *API) execute(
+	route *proxyPkg.Route,
+	r *http.Request,
+) (map[string]string, error) {
+
+	var request struct {
+		Command string `json:"command"`
+	}
+	err := decode(r, &request)
+	if err != nil {
+		return nil, err
+	}
+	if request.Command == "" {
+		err := errors.New("command: must not be empty")
+		return nil, httpError{http.StatusBadRequest, err}
+	}
+
+	// Check for error case
+	if route.Server().State() != serverPkg.Running {
+		err := errors.New("server is not running")
+		return nil, httpError{http.StatusConflict, err}
+	}
+
+	a.logger.Printf("executing command: %s\n", request.Command)
+	ctx, cancel := context.WithTimeout(r.Context(), executeTimeout)
+	defer cancel()
+	output, err := route.Server().Execute(ctx, request.Command)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"output": output}, nil
+
+}
+
+// newServer returns the response of a server.
+func newServer(name string, route *proxyPkg.Route) server {
+
+	s := server{}
+	s.Name = name
+	s.State = route.Server().State().String()
+	if uptimer, ok := route.Server().(serverPkg.Uptimer); ok {
+		s.Uptime = int64(uptimer.Uptime().Seconds())
+	}
+	s.Players = route.PlayerCount()
+	if stopTime, ok := route.StopTime(); ok {
+		s.StopTime = &stopTime
+	}
+	return s
+
+}
+
+// decode decodes the JSON body of a request.
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		err := fmt.Errorf("bad request body: %s", err)
+		return httpError{http.StatusBadRequest, err}
+	}
+	return nil
+}
+
+// stateError returns an error of starting or stopping a server, as a
+// conflict if the server is in the wrong state.
+func stateError(err error) error {
+	if errors.Is(err, serverPkg.ErrNotStopped) ||
+		errors.Is(err, serverPkg.ErrStopped) {
+		return httpError{http.StatusConflict, err}
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	proxyPkg "golem/proxy"
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// request serves a request with a body to an API with its token, returning
+// the status code and the decoded response.
+func request(
+	t *testing.T,
+	a *API,
+	method string,
+	path string,
+	body string,
+) (int, interface{}) {
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+a.token)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+
+	var response interface{}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("%s %s: decoding response: %s", method, path, err)
+	}
+	return w.Code, response
+
+}
+
+func TestReload(t *testing.T) {
+
+	reloads := 0
+	var reloadErr error
+	a := NewAPI(
+		log.New(io.Discard, "", 0),
+		"secret",
+		func() map[string]*proxyPkg.Route { return nil },
+		func() error {
+			reloads++
+			return reloadErr
+		},
+	)
+
+	// A good config lists the servers
+	code, response := request(t, a, http.MethodPost, "/reload", "")
+	if code != http.StatusOK || reloads != 1 {
+		t.Errorf("reload: got %d, %v after %d reloads", code, response,
+			reloads)
+	}
+
+	// A bad config is a bad request with its error
+	reloadErr = errors.New("servers.mc.idle.stopTimeout: invalid duration")
+	code, response = request(t, a, http.MethodPost, "/reload", "")
+	got, _ := response.(map[string]interface{})
+	if code != http.StatusBadRequest || got["error"] != reloadErr.Error() {
+		t.Errorf("bad reload: got %d, %v, want 400, %s", code, response,
+			reloadErr)
+	}
+
+	// Only POST reloads
+	code, _ = request(t, a, http.MethodGet, "/reload", "")
+	if code != http.StatusMethodNotAllowed || reloads != 2 {
+		t.Errorf("get reload: got %d after %d reloads", code, reloads)
+	}
+
+}
+
+// A failingServer is a fake server whose starts fail.
+type failingServer struct {
+	*servertest.Server
+}
+
+func (s failingServer) Start() error {
+	return errors.New("start failed")
+}
+
+// newTestAPI returns a new API with the token "secret" of routes to fake
+// servers: "running" with its stop timer running, "stopped", and "failing"
+// whose starts fail.
+func newTestAPI() *API {
+
+	logger := log.New(io.Discard, "", 0)
+	stopDuration := time.Hour
+	route := func(name string, server serverPkg.Server) *proxyPkg.Route {
+		return proxyPkg.NewRoute(logger, server, proxyPkg.RouteOptions{
+			Name:         name,
+			ServerAddr:   "127.0.0.1:1",
+			StopDuration: &stopDuration,
+		})
+	}
+	routes := map[string]*proxyPkg.Route{
+		"running": route("running", servertest.NewServer(serverPkg.Running)),
+		"stopped": route("stopped", servertest.NewServer(serverPkg.Stopped)),
+		"failing": route("failing", failingServer{
+			servertest.NewServer(serverPkg.Stopped),
+		}),
+	}
+	routes["running"].Idle()
+
+	return NewAPI(
+		logger,
+		"secret",
+		func() map[string]*proxyPkg.Route { return routes },
+		func() error { return nil },
+	)
+
+}
+
+func TestServeHTTP(t *testing.T) {
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		want   string // in the response
+	}{
+		// Listing and routing
+		{"GET", "/servers", "", 200, `"name":"failing"`},
+		{"GET", "/servers/running", "", 200, `"playerList":[]`},
+		{"GET", "/servers/", "", 200, `"name":"stopped"`},
+		{"GET", "/", "", 404, "not found"},
+		{"GET", "/status", "", 404, "not found"},
+		{"GET", "/servers/creative", "", 404, `unknown server \"creative\"`},
+		{"GET", "/servers/running/players", "", 404, "not found"},
+		{"GET", "/servers/running/start/now", "", 404, "not found"},
+		{"DELETE", "/servers", "", 405, "method not allowed"},
+		{"PUT", "/servers/running", "", 405, "method not allowed"},
+		{"GET", "/servers/running/start", "", 405, "method not allowed"},
+		{"PUT", "/servers/running/idle", "", 405, "method not allowed"},
+
+		// Starting and stopping, where the wrong state is a conflict
+		{"POST", "/servers/stopped/start", "", 200, `"state":"running"`},
+		{"POST", "/servers/running/start", "", 409, "not stopped"},
+		{"POST", "/servers/failing/start", "", 500, "start failed"},
+		{"POST", "/servers/running/stop", "", 200, `"state":"stopped"`},
+		{"POST", "/servers/stopped/stop", "", 409, "stopped"},
+		{"POST", "/servers/running/restart", "", 200, `"state":"running"`},
+		{"POST", "/servers/stopped/restart", "", 200, `"state":"running"`},
+		{"POST", "/servers/failing/restart", "", 500, "start failed"},
+
+		// Stop timers
+		{"DELETE", "/servers/running/idle", "", 200, `"stopTime":null`},
+		{"DELETE", "/servers/stopped/idle", "", 409, "not running"},
+		{"POST", "/servers/running/idle", `{"extend": "5m"}`, 200,
+			`"stopTime":"`},
+		{"POST", "/servers/stopped/idle", `{"extend": "5m"}`, 409,
+			"not running"},
+		{"POST", "/servers/running/idle", `{"extend": "-5m"}`, 400,
+			`extend: invalid duration \"-5m\"`},
+		{"POST", "/servers/running/idle", `{"extend": "soon"}`, 400,
+			`extend: invalid duration \"soon\"`},
+
+		// Request bodies
+		{"POST", "/servers/running/idle", "", 400, "bad request body: EOF"},
+		{"POST", "/servers/running/execute", `{"command":`, 400,
+			"bad request body: unexpected EOF"},
+		{"POST", "/servers/running/execute", `{"cmd": "list"}`, 400,
+			`bad request body: json: unknown field \"cmd\"`},
+		{"POST", "/servers/running/execute", `["list"]`, 400,
+			"bad request body: json: cannot unmarshal array"},
+
+		// Commands
+		{"POST", "/servers/running/execute", `{"command": "list"}`, 200,
+			`{"output":"executed list"}`},
+		{"POST", "/servers/running/execute", `{"command": ""}`, 400,
+			"command: must not be empty"},
+		{"POST", "/servers/stopped/execute", `{"command": "list"}`, 409,
+			"server is not running"},
+	}
+
+	for _, test := range tests {
+		code, response := request(
+			t,
+			newTestAPI(),
+			test.method,
+			test.path,
+			test.body,
+		)
+		data, _ := json.Marshal(response)
+		if code != test.code || !strings.Contains(string(data), test.want) {
+			t.Errorf("%s %s %s: got %d %s, want %d %s", test.method,
+				test.path, test.body, code, data, test.code, test.want)
+		}
+	}
+
+}
+
+func TestServeHTTPToken(t *testing.T) {
+
+	a := newTestAPI()
+	for _, header := range []string{"", "secret", "Bearer", "Bearer wrong"} {
+		r := httptest.NewRequest(http.MethodGet, "/servers", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized ||
+			w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("authorization %q: got %d", header, w.Code)
+		}
+	}
+
+}
+
+func TestRestartStopsOnce(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Running)
+	stopDuration := time.Hour
+	route := proxyPkg.NewRoute(
+		log.New(io.Discard, "", 0),
+		server,
+		proxyPkg.RouteOptions{StopDuration: &stopDuration},
+	)
+	a := NewAPI(
+		log.New(io.Discard, "", 0),
+		"secret",
+		func() map[string]*proxyPkg.Route {
+			return map[string]*proxyPkg.Route{"mc": route}
+		},
+		func() error { return nil },
+	)
+
+	// Restarted servers stop again if nobody joins
+	code, _ := request(t, a, http.MethodPost, "/servers/mc/restart", "")
+	if code != http.StatusOK || server.Stops() != 1 {
+		t.Errorf("restart: got %d after %d stops", code, server.Stops())
+	}
+	if _, ok := route.StopTime(); !ok {
+		t.Error("stop timer not running after restart")
+	}
+
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golem/config"
+	serverPkg "golem/server"
+	"golem/server/remote"
+)
+
+// runAgent runs golem agent, which serves the servers of a config to remote
+// servers of other golem instances instead of proxying.
+func runAgent(args []string) {
+
+	var configPath string
+
+	// Define flags
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", os.Getenv("GOLEM_CONFIG"),
+		"Config file (JSON)")
+	flags.Parse(args)
+
+	// Load config
+	err := func() error {
+		if configPath == "" {
+			return fmt.Errorf("config: must not be empty")
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return err
+		}
+		err = cfg.ValidateAgent()
+		if err != nil {
+			return err
+		}
+
+		// Make servers
+		logger := newLogger("[agent] ")
+		servers := make(map[string]serverPkg.Server)
+		for _, name := range cfg.ServerNames() {
+			servers[name] = newServer(name, cfg.Servers[name])
+		}
+
+		// Listen for SIGINT or SIGTERM and safely exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-c
+			stopServers(logger, cfg.ServerNames(), servers)
+			os.Exit(1)
+		}()
+
+		agent := remote.NewAgent(logger, cfg.Agent.Token, servers)
+		return agent.ListenAndServe(cfg.Agent.Addr)
+	}()
+	if err != nil {
+		fmt.Printf("error running agent: %s\n", err)
+		os.Exit(1)
+	}
+
+}
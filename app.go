@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"golem/config"
+	proxyPkg "golem/proxy"
+	serverPkg "golem/server"
+)
+
+// An app holds the servers, routes and proxies made from a config, so they
+// can be updated when the config is reloaded.
+type app struct {
+	logger     *log.Logger
+	configPath string
+	newServer  func(name string, c *config.Server) serverPkg.Server
+
+	mu      sync.Mutex
+	cfg     *config.Config
+	servers map[string]serverPkg.Server // by server name
+	routes  map[string]*proxyPkg.Route  // by server name
+	proxies []*proxyPkg.Proxy           // by listener
+
+	// Removed servers that still had players, by server, with their names,
+	// until they stop
+	draining map[serverPkg.Server]string
+}
+
+// newApp makes the servers, routes and proxies of a config, making server
+// managers with newServer.
+func newApp(
+	logger *log.Logger,
+	configPath string,
+	cfg *config.Config,
+	newServer func(name string, c *config.Server) serverPkg.Server,
+) *app {
+
+	a := app{}
+	a.logger = logger
+	a.configPath = configPath
+	a.newServer = newServer
+	a.cfg = cfg
+	a.servers = make(map[string]serverPkg.Server)
+	a.routes = make(map[string]*proxyPkg.Route)
+	a.draining = make(map[serverPkg.Server]string)
+
+	for _, name := range cfg.ServerNames() {
+		c := cfg.Servers[name]
+		a.servers[name] = a.newServer(name, c)
+		a.routes[name] = newRoute(name, c, a.servers[name])
+
+		// Stop adopted servers if nobody joins
+		a.routes[name].Idle()
+	}
+
+	// Make optional packet logger
+	var protocolLogger *log.Logger
+	if cfg.Debug {
+		protocolLogger = newLogger("[protocol] ")
+	}
+
+	for _, l := range cfg.Listeners {
+		proxy := proxyPkg.NewProxy(
+			newLogger("[proxy] "),
+			l.Addr,
+			nil,
+			protocolLogger,
+		)
+		a.proxies = append(a.proxies, proxy)
+	}
+	a.setRoutes()
+
+	return &a
+
+}
+
+// Run runs all proxies, returning the first error.
+func (a *app) Run() error {
+	errs := make(chan error)
+	for _, proxy := range a.proxies {
+		proxy := proxy
+		go func() {
+			errs <- proxy.Run()
+		}()
+	}
+	return <-errs
+}
+
+// Routes returns the routes by server name.
+func (a *app) Routes() map[string]*proxyPkg.Route {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	routes := make(map[string]*proxyPkg.Route)
+	for name, route := range a.routes {
+		routes[name] = route
+	}
+	return routes
+}
+
+// Stop stops all servers that are not stopped, including removed servers
+// that still had players, except detached servers, then closes them.
+func (a *app) Stop() {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stopServers(a.logger, a.cfg.ServerNames(), a.servers)
+	for server, name := range a.draining {
+		stopServer(a.logger, name, server)
+	}
+
+	for name, server := range a.servers {
+		closeServer(a.logger, name, server)
+	}
+	for server, name := range a.draining {
+		closeServer(a.logger, name, server)
+	}
+
+}
+
+// stopServers stops servers by name that are not stopped, except detached
+// servers.
+func stopServers(
+	logger *log.Logger,
+	names []string,
+	servers map[string]serverPkg.Server,
+) {
+	for _, name := range names {
+		stopServer(logger, name, servers[name])
+	}
+}
+
+// stopServer stops a server unless it is stopped or detached.
+func stopServer(logger *log.Logger, name string, server serverPkg.Server) {
+	if server.State() == serverPkg.Stopped {
+		return
+	}
+	if detacher, ok := server.(serverPkg.Detacher); ok &&
+		detacher.Detached() {
+		logger.Printf("leaving detached server running: %s\n", name)
+		return
+	}
+	server.Stop()
+}
+
+// Reload reloads the config and applies it without dropping connections.
+// Existing connections keep their route and server address.
+// A bad config is rejected, keeping the current config.
+func (a *app) Reload() error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		return err
+	}
+
+	// Listen addresses are fixed while running
+	if len(cfg.Listeners) != len(a.proxies) {
+		return fmt.Errorf(
+			"listeners: adding or removing listeners requires a restart",
+		)
+	}
+	for i, l := range cfg.Listeners {
+		if l.Addr != a.proxies[i].Addr() {
+			return fmt.Errorf(
+				"listeners[%d].addr: changing the address requires a restart",
+				i,
+			)
+		}
+	}
+	if cfg.Debug != a.cfg.Debug {
+		a.logger.Println("debug change applies after restart")
+	}
+	if cfg.Admin != a.cfg.Admin {
+		a.logger.Println("admin change applies after restart")
+	}
+
+	// Update existing servers and make new servers
+	servers := make(map[string]serverPkg.Server)
+	routes := make(map[string]*proxyPkg.Route)
+	for _, name := range cfg.ServerNames() {
+
+		c := cfg.Servers[name]
+		server, ok := a.servers[name]
+		if !ok {
+			a.logger.Printf("adding server: %s\n", name)
+			servers[name] = a.newServer(name, c)
+			routes[name] = newRoute(name, c, servers[name])
+			routes[name].Idle()
+			continue
+		}
+
+		// Keep the running manager
+		if !reflect.DeepEqual(c.Manager, a.cfg.Servers[name].Manager) {
+			a.logger.Printf(
+				"manager change of server %s applies after restart\n",
+				name,
+			)
+			c.Manager = a.cfg.Servers[name].Manager
+		}
+
+		servers[name] = server
+		routes[name] = a.routes[name]
+		routes[name].Update(newRoute(name, c, server))
+
+	}
+
+	// Stop and close removed servers without players, and keep the others
+	// until their players leave and the stop timer stops them
+	for name, server := range a.servers {
+		if _, ok := servers[name]; ok {
+			continue
+		}
+		a.logger.Printf("removing server: %s\n", name)
+		route := a.routes[name]
+		if route.PlayerCount() > 0 &&
+			server.State() != serverPkg.Stopped {
+			a.drain(name, server, route)
+			continue
+		}
+		route.CancelStopTimer()
+		name, server := name, server
+		go func() {
+			if server.State() != serverPkg.Stopped {
+				server.Stop()
+			}
+			closeServer(a.logger, name, server)
+		}()
+	}
+
+	a.cfg = cfg
+	a.servers = servers
+	a.routes = routes
+	a.setRoutes()
+
+	a.logger.Println("config reloaded")
+	return nil
+
+}
+
+// drain keeps a removed server until it stops, so it is stopped on exit,
+// then cancels the timers of its route and closes it. Must hold mu.
+func (a *app) drain(
+	name string,
+	server serverPkg.Server,
+	route *proxyPkg.Route,
+) {
+
+	a.draining[server] = name
+	events, cancel := server.Subscribe()
+	go func() {
+
+		defer cancel()
+		for server.State() != serverPkg.Stopped {
+			if _, ok := <-events; !ok {
+				return
+			}
+		}
+
+		a.mu.Lock()
+		delete(a.draining, server)
+		a.mu.Unlock()
+		a.logger.Printf("removed server stopped: %s\n", name)
+		route.CancelStopTimer()
+		closeServer(a.logger, name, server)
+
+	}()
+
+}
+
+// closeServer ends the background work of a server if it has any.
+func closeServer(logger *log.Logger, name string, server serverPkg.Server) {
+	closer, ok := server.(serverPkg.Closer)
+	if !ok {
+		return
+	}
+	err := closer.Close()
+	if err != nil {
+		logger.Printf("error closing server %s: %s\n", name, err)
+	}
+}
+
+// setRoutes sets the routes of each proxy from the config.
+func (a *app) setRoutes() {
+	for i, l := range a.cfg.Listeners {
+		routes := make(map[string]*proxyPkg.Route)
+		for hostname, name := range l.Routes {
+			routes[hostname] = a.routes[name]
+		}
+		a.proxies[i].SetRoutes(routes, a.routes[l.Default])
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golem/config"
+	"golem/protocol"
+	protocolDefinitions "golem/protocol/protocol"
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// A testApp is an app of a config file whose servers are fake servers.
+type testApp struct {
+	*app
+	path string
+
+	mu      sync.Mutex
+	servers map[string]*servertest.Server // by name, latest made
+}
+
+// newTestApp returns a new testApp of a config, whose servers are made in a
+// state.
+func newTestApp(
+	t *testing.T,
+	data string,
+	state serverPkg.ServerState,
+) *testApp {
+
+	a := testApp{}
+	a.path = filepath.Join(t.TempDir(), "golem.json")
+	a.servers = make(map[string]*servertest.Server)
+	a.write(t, data)
+
+	cfg, err := loadConfig(a.path)
+	if err != nil {
+		t.Fatalf("loading config: %s", err)
+	}
+	a.app = newApp(
+		log.New(io.Discard, "", 0),
+		a.path,
+		cfg,
+		func(name string, c *config.Server) serverPkg.Server {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.servers[name] = servertest.NewServer(state)
+			return a.servers[name]
+		},
+	)
+	return &a
+
+}
+
+// write writes the config file.
+func (a *testApp) write(t *testing.T, data string) {
+	t.Helper()
+	err := os.WriteFile(a.path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// server returns the latest fake server made with a name.
+func (a *testApp) server(name string) *servertest.Server {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.servers[name]
+}
+
+// testConfig returns a config with a listener on addr routing to servers by
+// name, with a stop timeout.
+func testConfig(addr string, stopTimeout string, names ...string) string {
+	var routes, servers []string
+	for _, name := range names {
+		routes = append(routes, fmt.Sprintf(`"%s.test": "%s"`, name, name))
+		servers = append(servers, fmt.Sprintf(`"%s": {
+			"addr": "127.0.0.1:1",
+			"manager": {"type": "process", "start": "java"},
+			"idle": {"stopTimeout": "%s"}
+		}`, name, stopTimeout))
+	}
+	return fmt.Sprintf(`{
+		"listeners": [{"addr": "%s", "routes": {%s}}],
+		"servers": {%s}
+	}`, addr, strings.Join(routes, ", "), strings.Join(servers, ", "))
+}
+
+// freeAddr returns a free local TCP address.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestReloadKeepsManagers(t *testing.T) {
+
+	data := testConfig(":25565", "1h", "a", "b")
+	a := newTestApp(t, data, serverPkg.Stopped)
+	server := a.server("a")
+	route := a.Routes()["a"]
+
+	// Manager changes apply after a restart, other changes at once
+	a.write(t, strings.Replace(
+		testConfig(":25565", "5m", "a", "b", "c"),
+		`"start": "java"`,
+		`"start": "java -Xmx4G"`,
+		1,
+	))
+	err := a.Reload()
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+
+	switch {
+	case a.server("a") != server || a.Routes()["a"] != route:
+		t.Error("server a was replaced")
+	case a.cfg.Servers["a"].Manager.Start != "java":
+		t.Errorf("got start %q, want java",
+			a.cfg.Servers["a"].Manager.Start)
+	case a.cfg.Servers["a"].Idle.StopTimeout != config.Seconds(300):
+		t.Errorf("got stop timeout %s",
+			a.cfg.Servers["a"].Idle.StopTimeout.Duration())
+	case a.server("c") == nil || a.Routes()["c"] == nil:
+		t.Error("server c was not added")
+	}
+
+}
+
+func TestReloadRejectsBadConfig(t *testing.T) {
+
+	data := testConfig(":25565", "1h", "a")
+	a := newTestApp(t, data, serverPkg.Stopped)
+	cfg := a.cfg
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		{testConfig(":25566", "1h", "a"),
+			"listeners[0].addr: changing the address requires a restart"},
+		{strings.Replace(data, `"listeners": [`, `"listeners": [{
+			"addr": ":25566", "default": "a"}, `, 1),
+			"listeners: adding or removing listeners requires a restart"},
+		{testConfig(":25565", "-1s", "a"),
+			"servers.a.idle.stopTimeout: must not be negative"},
+		{`{"listeners": [`, a.path + ": unexpected end of JSON input"},
+	}
+
+	for _, test := range tests {
+		a.write(t, test.data)
+		err := a.Reload()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("got error %v, want %s", err, test.want)
+		}
+		if a.cfg != cfg {
+			t.Error("bad config was applied")
+		}
+	}
+
+}
+
+func TestReloadRemovesServers(t *testing.T) {
+
+	data := testConfig(":25565", "1h", "a", "b")
+	a := newTestApp(t, data, serverPkg.Stopped)
+	running := a.server("a")
+	stopped := a.server("b")
+	running.Start()
+	route := a.Routes()["a"]
+	route.Idle()
+
+	a.write(t, testConfig(":25565", "1h"))
+	err := a.Reload()
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+
+	// Servers without players are stopped and closed, with their timers
+	servertest.Eventually(t, running.Closed, "running server closed")
+	servertest.Eventually(t, stopped.Closed, "stopped server closed")
+	if running.State() != serverPkg.Stopped || running.Stops() != 1 {
+		t.Errorf("running server is %s after %d stops", running.State(),
+			running.Stops())
+	}
+	if stopped.Stops() != 0 {
+		t.Errorf("stopped server got %d stops", stopped.Stops())
+	}
+	if _, ok := route.StopTime(); ok {
+		t.Error("stop timer of removed server is running")
+	}
+
+}
+
+func TestReloadDrainsServers(t *testing.T) {
+
+	// Accept the connection of the player
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	addr := freeAddr(t)
+	data := strings.Replace(
+		testConfig(addr, "50ms", "a"),
+		"127.0.0.1:1",
+		backend.Addr().String(),
+		1,
+	)
+	a := newTestApp(t, data, serverPkg.Stopped)
+	server := a.server("a")
+	server.Start()
+	go a.Run()
+
+	// Log in while the server runs
+	conn := login(t, addr, "a.test")
+	route := a.Routes()["a"]
+	servertest.Eventually(
+		t,
+		func() bool { return route.PlayerCount() == 1 },
+		"player connected",
+	)
+
+	// The server keeps running while the player plays
+	a.write(t, testConfig(addr, "50ms"))
+	err = a.Reload()
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+	if server.State() != serverPkg.Running || server.Closed() {
+		t.Fatalf("removed server with player is %s", server.State())
+	}
+
+	// The stop timer stops it after the player leaves
+	conn.Close()
+	servertest.Wait(t, server, serverPkg.Stopped)
+	servertest.Eventually(t, server.Closed, "removed server closed")
+	a.mu.Lock()
+	draining := len(a.draining)
+	a.mu.Unlock()
+	if draining != 0 {
+		t.Errorf("%d servers still draining", draining)
+	}
+
+}
+
+// login connects to a proxy and logs in to a hostname with protocol 756.
+func login(t *testing.T, addr string, hostname string) net.Conn {
+
+	var conn net.Conn
+	servertest.Eventually(
+		t,
+		func() bool {
+			var err error
+			conn, err = net.Dial("tcp", addr)
+			return err == nil
+		},
+		"proxy listening",
+	)
+
+	err := protocol.NewClientConn(conn, nil).WriteHandshakePacket(
+		protocolDefinitions.HandshakePacket{
+			ProtocolVersion: 756,
+			ServerAddress:   hostname,
+			ServerPort:      25565,
+			NextState:       protocolDefinitions.NextStateLoginRequest,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Login start: length, packet id and name
+	name := "Steve"
+	data := append([]byte{byte(2 + len(name)), 0, byte(len(name))}, name...)
+	_, err = conn.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+
+}
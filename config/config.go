@@ -0,0 +1,799 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golem/protocol/chat"
+)
+
+// A Config is the configuration of golem: listeners routing to servers.
+type Config struct {
+	Debug     bool               `json:"debug"`
+	Listeners []*Listener        `json:"listeners"`
+	Servers   map[string]*Server `json:"servers"`
+	Agent     Agent              `json:"agent"`
+	Admin     Admin              `json:"admin"`
+}
+
+// An Admin configures the HTTP admin API at addr, authenticated with token,
+// where an empty addr disables it.
+type Admin struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+// An Agent configures golem agent, which serves the servers of the config to
+// remote servers connecting to addr with token, instead of proxying.
+type Agent struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+// A Listener is a proxy listen address and its routes.
+type Listener struct {
+	Addr    string            `json:"addr"`
+	Routes  map[string]string `json:"routes"`  // hostname to server name
+	Default string            `json:"default"` // server name, empty rejects others
+}
+
+// A Server is a Minecraft server behind the proxy and how it is managed.
+type Server struct {
+	Addr     string   `json:"addr"`
+	Manager  Manager  `json:"manager"`
+	Idle     Idle     `json:"idle"`
+	Login    Login    `json:"login"`
+	Status   Status   `json:"status"`
+	Messages Messages `json:"messages"`
+}
+
+// Manager types
+const (
+	ManagerBasic      = "basic"
+	ManagerProcess    = "process"
+	ManagerRcon       = "rcon"
+	ManagerDocker     = "docker"
+	ManagerRemote     = "remote"
+	ManagerKubernetes = "kubernetes"
+)
+
+// A Manager configures the server manager.
+type Manager struct {
+	Type      string `json:"type"`
+	Start     string `json:"start"`
+	Directory string `json:"directory"`
+
+	// Ready decides when a process server is running, and StartTimeout
+	// fails starts taking longer, where zero disables it
+	Ready        Ready    `json:"ready"`
+	StartTimeout Duration `json:"startTimeout"`
+
+	// Stop configures how a process server is stopped, and Restart how it
+	// is restarted after a crash
+	Stop    Stop    `json:"stop"`
+	Restart Restart `json:"restart"`
+
+	// Detach keeps a process server running when golem exits, with its
+	// console in a FIFO and its output in a log file
+	Detach bool `json:"detach"`
+
+	// Rcon configures an rcon server, where Start is an optional shell
+	// command, and commands of a docker server if the password is set
+	Rcon Rcon `json:"rcon"`
+
+	// Docker configures a docker server
+	Docker Docker `json:"docker"`
+
+	// Remote configures a remote server
+	Remote Remote `json:"remote"`
+
+	// Kubernetes configures a kubernetes server, which executes commands
+	// over RCON
+	Kubernetes Kubernetes `json:"kubernetes"`
+
+	// Wol wakes the host of any server with Wake-on-LAN if mac is set
+	Wol Wol `json:"wol"`
+}
+
+// A Kubernetes configures a server in the StatefulSet statefulSet, scaled
+// between 0 and 1 replicas through the Kubernetes API. The API is the one of
+// the cluster with the service account of the pod, unless api is set, such as
+// to the address of kubectl proxy. The namespace is by default the one of the
+// service account, and the StatefulSet is inspected every interval.
+type Kubernetes struct {
+	API         string   `json:"api"`
+	TokenFile   string   `json:"tokenFile"`
+	CAFile      string   `json:"caFile"`
+	Namespace   string   `json:"namespace"`
+	StatefulSet string   `json:"statefulSet"`
+	Interval    Duration `json:"interval"`
+}
+
+// A Wol configures Wake-on-LAN for a server on a host that sleeps while the
+// server is stopped. Starts send the magic packet for mac to the UDP address
+// broadcast every interval until the TCP address host is reachable, for at
+// most timeout. The optional shell command suspend is run after idle stops.
+type Wol struct {
+	MAC       string   `json:"mac"`
+	Broadcast string   `json:"broadcast"`
+	Host      string   `json:"host"`
+	Interval  Duration `json:"interval"`
+	Timeout   Duration `json:"timeout"`
+	Suspend   string   `json:"suspend"`
+}
+
+// A Remote configures a server of golem agent at addr, authenticated with
+// token. Server is the server name on the agent, by default the same name.
+// Connections are retried every interval.
+type Remote struct {
+	Addr     string   `json:"addr"`
+	Token    string   `json:"token"`
+	Server   string   `json:"server"`
+	Interval Duration `json:"interval"`
+}
+
+// A Docker configures a server in a Docker container, started and stopped
+// through the Engine API at socket. The container is inspected every
+// interval.
+type Docker struct {
+	Socket    string   `json:"socket"`
+	Container string   `json:"container"`
+	Interval  Duration `json:"interval"`
+}
+
+// An Rcon configures a server run by other tooling, with commands executed
+// over RCON at addr with password. Its state is polled every interval, and it
+// is stopped by the shell command stop, or else the RCON stop command.
+type Rcon struct {
+	Addr     string   `json:"addr"`
+	Password string   `json:"password"`
+	Interval Duration `json:"interval"`
+	Stop     string   `json:"stop"`
+}
+
+// Readiness types
+const (
+	ReadyConsole = "console"
+	ReadyTCP     = "tcp"
+	ReadyStatus  = "status"
+)
+
+// A Stop configures the stop sequence of a process server: an optional
+// world save, the stop command, SIGTERM after timeout and SIGKILL after
+// termTimeout, all within deadline.
+type Stop struct {
+	Save        bool     `json:"save"`
+	SaveTimeout Duration `json:"saveTimeout"`
+	Timeout     Duration `json:"timeout"`
+	TermTimeout Duration `json:"termTimeout"`
+	Deadline    Duration `json:"deadline"`
+}
+
+// A Restart configures restarts of a process server that crashed, when
+// onCrash is set. Restarts wait for backoff, doubling up to maxBackoff for
+// each consecutive crash, and give up after maxAttempts. Crashes are
+// consecutive unless the server ran for resetAfter.
+type Restart struct {
+	OnCrash     bool     `json:"onCrash"`
+	Backoff     Duration `json:"backoff"`
+	MaxBackoff  Duration `json:"maxBackoff"`
+	MaxAttempts int      `json:"maxAttempts"`
+	ResetAfter  Duration `json:"resetAfter"`
+}
+
+// A Ready configures how a process server is detected as running: a console
+// line matching a pattern, a TCP connect to the server address, or a status
+// ping to the server address, probed every interval.
+type Ready struct {
+	Type     string   `json:"type"`
+	Pattern  string   `json:"pattern"`
+	Interval Duration `json:"interval"`
+}
+
+// An Idle configures autostart/stop, which is enabled for all managers except
+// the basic manager. Managers that can pause are paused after PauseTimeout
+// if it is not zero, and stopped after the longer StopTimeout.
+type Idle struct {
+	StopTimeout  Duration `json:"stopTimeout"`
+	PauseTimeout Duration `json:"pauseTimeout"`
+}
+
+// A Login configures logins while the server is not running.
+type Login struct {
+	// Hold keeps logins open while the server starts for at most
+	// HoldTimeout, instead of disconnecting with a message
+	Hold        bool     `json:"hold"`
+	HoldTimeout Duration `json:"holdTimeout"`
+
+	// Limbo finishes logins of supported clients and keeps them waiting in
+	// an empty world for at most LimboTimeout, taking priority over Hold
+	Limbo        bool     `json:"limbo"`
+	LimboTimeout Duration `json:"limboTimeout"`
+}
+
+// A Status configures the status response.
+type Status struct {
+	MOTD            string `json:"motd"` // template, default "{state}"
+	VersionName     string `json:"versionName"`
+	VersionProtocol int    `json:"versionProtocol"`
+	PlayersMax      int    `json:"playersMax"`
+
+	// Forward relays the server status while running, cached for
+	// CacheDuration
+	Forward       bool     `json:"forward"`
+	CacheDuration Duration `json:"cacheDuration"`
+
+	// LastKnown shows the last forwarded status while the server is not
+	// running, saved to LastKnownFile (default golem-status.json in the
+	// manager directory)
+	LastKnown      bool   `json:"lastKnown"`
+	LastKnownFile  string `json:"lastKnownFile"`
+	SleepingSuffix string `json:"sleepingSuffix"`
+	StartingSuffix string `json:"startingSuffix"`
+
+	// Favicon is a 64x64 PNG (default server-icon.png in the manager
+	// directory)
+	Favicon string `json:"favicon"`
+
+	// PlayerSample caps the players shown when hovering the player count,
+	// whose names are hidden if HidePlayerNames
+	PlayerSample    int  `json:"playerSample"`
+	HidePlayerNames bool `json:"hidePlayerNames"`
+}
+
+// Messages configures the status descriptions and disconnect messages.
+// Messages are templates of either text with legacy formatting codes or JSON
+// chat components, with placeholders such as {players}. Empty messages use
+// the defaults.
+type Messages struct {
+	StatusStarting string `json:"statusStarting"`
+	StatusStopping string `json:"statusStopping"`
+	StatusRunning  string `json:"statusRunning"`
+	StatusStopped  string `json:"statusStopped"`
+	StatusCrashed  string `json:"statusCrashed"`
+	StatusPaused   string `json:"statusPaused"`
+	Stopped        string `json:"stopped"`
+	Starting       string `json:"starting"`
+	Stopping       string `json:"stopping"`
+	StartInitiated string `json:"startInitiated"`
+	StartFailed    string `json:"startFailed"`
+	Crashed        string `json:"crashed"`
+	ConnectFailed  string `json:"connectFailed"`
+	LimboTitle     string `json:"limboTitle"`
+	Ready          string `json:"ready"`
+}
+
+// DefaultServerName is the name of the server in the default configuration.
+const DefaultServerName = "default"
+
+// Default returns the configuration used without a config file: one listener
+// routing everything to one unmanaged server.
+func Default() *Config {
+	c := Config{}
+	c.Listeners = []*Listener{defaultListener()}
+	c.Listeners[0].Default = DefaultServerName
+	c.Servers = map[string]*Server{DefaultServerName: defaultServer()}
+	c.Agent = defaultAgent()
+	return &c
+}
+
+// defaultAgent returns an agent with default values.
+func defaultAgent() Agent {
+	return Agent{
+		Addr: ":25580",
+	}
+}
+
+// defaultListener returns a listener with default values.
+func defaultListener() *Listener {
+	return &Listener{
+		Addr:   ":25565",
+		Routes: map[string]string{},
+	}
+}
+
+// defaultServer returns a server with default values.
+func defaultServer() *Server {
+	return &Server{
+		Addr: ":25566",
+		Manager: Manager{
+			Type: ManagerBasic,
+			Ready: Ready{
+				Type:     ReadyConsole,
+				Pattern:  `INFO.*Done`,
+				Interval: Seconds(1),
+			},
+			Stop: Stop{
+				SaveTimeout: Seconds(30),
+				Timeout:     Seconds(60),
+				TermTimeout: Seconds(10),
+				Deadline:    Seconds(120),
+			},
+			Restart: Restart{
+				Backoff:     Seconds(5),
+				MaxBackoff:  Seconds(300),
+				MaxAttempts: 5,
+				ResetAfter:  Seconds(600),
+			},
+			Rcon: Rcon{
+				Addr:     ":25575",
+				Interval: Seconds(5),
+			},
+			Docker: Docker{
+				Socket:   "/var/run/docker.sock",
+				Interval: Seconds(2),
+			},
+			Remote: Remote{
+				Interval: Seconds(5),
+			},
+			Kubernetes: Kubernetes{
+				Interval: Seconds(5),
+			},
+			Wol: Wol{
+				Broadcast: "255.255.255.255:9",
+				Interval:  Seconds(2),
+				Timeout:   Seconds(120),
+			},
+		},
+		Idle: Idle{
+			StopTimeout: Seconds(60),
+		},
+		Login: Login{
+			HoldTimeout:  Seconds(25),
+			LimboTimeout: Seconds(300),
+		},
+		Status: Status{
+			VersionName:     "1.17.1",
+			VersionProtocol: 756,
+			PlayersMax:      20,
+			Forward:         true,
+			CacheDuration:   Seconds(5),
+			LastKnown:       true,
+			SleepingSuffix:  "(sleeping – join to wake)",
+			StartingSuffix:  "(starting...)",
+			PlayerSample:    12,
+		},
+	}
+}
+
+// Load reads a configuration from a JSON file. Missing keys take default
+// values. The configuration is not validated.
+func Load(path string) (*Config, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for unknown keys and bad values first to point to the key
+	var raw interface{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	err = checkKeys(raw, reflect.TypeOf(Config{}), "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	// Decode the top level, deferring listeners and servers to fill defaults
+	var file struct {
+		Debug     bool                       `json:"debug"`
+		Listeners []json.RawMessage          `json:"listeners"`
+		Servers   map[string]json.RawMessage `json:"servers"`
+		Agent     Agent                      `json:"agent"`
+		Admin     Admin                      `json:"admin"`
+	}
+	file.Agent = defaultAgent()
+	err = decode(data, &file, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	c := Config{}
+	c.Debug = file.Debug
+	c.Agent = file.Agent
+	c.Admin = file.Admin
+	c.Servers = make(map[string]*Server)
+
+	for i, raw := range file.Listeners {
+		l := defaultListener()
+		err = decode(raw, l, fmt.Sprintf("listeners[%d]", i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		c.Listeners = append(c.Listeners, l)
+	}
+
+	for name, raw := range file.Servers {
+		s := defaultServer()
+		err = decode(raw, s, "servers."+name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		c.Servers[name] = s
+	}
+
+	return &c, nil
+
+}
+
+// decode strictly decodes JSON into v, prefixing errors with the key of v.
+func decode(data []byte, v interface{}, key string) error {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	// Point to the bad key where possible
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return fmt.Errorf(
+			"%s: expected %s but got %s",
+			joinKey(key, typeErr.Field),
+			typeErr.Type,
+			typeErr.Value,
+		)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Errorf("%s: unknown key %s", keyOrRoot(key), field)
+	}
+	return fmt.Errorf("%s: %s", keyOrRoot(key), err)
+
+}
+
+// checkKeys walks decoded JSON alongside the type it decodes into, returning
+// an error for the first unknown key or invalid duration.
+// Other type errors are left to the decoder.
+func checkKeys(v interface{}, t reflect.Type, key string) error {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(Duration(0)) {
+		var d Duration
+		data, _ := json.Marshal(v)
+		if d.UnmarshalJSON(data) != nil {
+			return fmt.Errorf("%s: invalid duration %s", key, data)
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		// Match keys case insensitively like the decoder
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			fields[strings.ToLower(name)] = f.Type
+		}
+
+		for _, k := range sortedKeys(m) {
+			fieldType, ok := fields[strings.ToLower(k)]
+			if !ok {
+				return fmt.Errorf("%s: unknown key", joinKey(key, k))
+			}
+			err := checkKeys(m[k], fieldType, joinKey(key, k))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, k := range sortedKeys(m) {
+			err := checkKeys(m[k], t.Elem(), joinKey(key, k))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		s, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, e := range s {
+			err := checkKeys(e, t.Elem(), fmt.Sprintf("%s[%d]", key, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// Validate checks that the configuration is usable, returning an error that
+// points to the bad key.
+func (c *Config) Validate() error {
+
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("listeners: must not be empty")
+	}
+	if c.Admin.Addr != "" && c.Admin.Token == "" {
+		return fmt.Errorf("admin.token: must not be empty")
+	}
+
+	for i, l := range c.Listeners {
+		key := fmt.Sprintf("listeners[%d]", i)
+		if l.Addr == "" {
+			return fmt.Errorf("%s.addr: must not be empty", key)
+		}
+		if l.Default != "" && c.Servers[l.Default] == nil {
+			return fmt.Errorf("%s.default: unknown server %q", key, l.Default)
+		}
+		for _, hostname := range sortedKeys(l.Routes) {
+			name := l.Routes[hostname]
+			if c.Servers[name] == nil {
+				return fmt.Errorf(
+					"%s.routes.%s: unknown server %q",
+					key,
+					hostname,
+					name,
+				)
+			}
+		}
+	}
+
+	return c.validateServers()
+
+}
+
+// ValidateAgent checks the config for golem agent, which needs no listeners,
+// returning an error starting with the bad key.
+func (c *Config) ValidateAgent() error {
+
+	switch {
+	case c.Agent.Addr == "":
+		return fmt.Errorf("agent.addr: must not be empty")
+	case c.Agent.Token == "":
+		return fmt.Errorf("agent.token: must not be empty")
+	}
+
+	return c.validateServers()
+
+}
+
+// validateServers checks all servers.
+func (c *Config) validateServers() error {
+	for _, name := range c.ServerNames() {
+		err := c.Servers[name].validate()
+		if err != nil {
+			return fmt.Errorf("servers.%s.%s", name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a server, returning an error starting with the bad key.
+func (s *Server) validate() error {
+
+	switch {
+	case s.Addr == "":
+		return fmt.Errorf("addr: must not be empty")
+	case s.Idle.StopTimeout < 0:
+		return fmt.Errorf("idle.stopTimeout: must not be negative")
+	case s.Idle.PauseTimeout < 0:
+		return fmt.Errorf("idle.pauseTimeout: must not be negative")
+	case s.Idle.PauseTimeout >= s.Idle.StopTimeout && s.Idle.PauseTimeout > 0:
+		return fmt.Errorf("idle.pauseTimeout: must be less than stopTimeout")
+	case s.Login.HoldTimeout < 0:
+		return fmt.Errorf("login.holdTimeout: must not be negative")
+	case s.Login.LimboTimeout < 0:
+		return fmt.Errorf("login.limboTimeout: must not be negative")
+	case s.Status.PlayersMax < 0:
+		return fmt.Errorf("status.playersMax: must not be negative")
+	case s.Status.CacheDuration < 0:
+		return fmt.Errorf("status.cacheDuration: must not be negative")
+	case s.Status.PlayerSample < 0:
+		return fmt.Errorf("status.playerSample: must not be negative")
+	}
+
+	// Check JSON templates
+	templates := map[string]string{
+		"status.motd":           s.Status.MOTD,
+		"status.sleepingSuffix": s.Status.SleepingSuffix,
+		"status.startingSuffix": s.Status.StartingSuffix,
+	}
+	messages := reflect.ValueOf(s.Messages)
+	for i := 0; i < messages.NumField(); i++ {
+		key := messages.Type().Field(i).Tag.Get("json")
+		templates["messages."+key] = messages.Field(i).String()
+	}
+	for _, key := range sortedKeys(templates) {
+		err := validateTemplate(templates[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+
+	switch s.Manager.Type {
+	case ManagerBasic:
+	case ManagerProcess:
+		if len(strings.Fields(s.Manager.Start)) == 0 {
+			return fmt.Errorf("manager.start: must not be empty")
+		}
+	case ManagerRcon:
+		if s.Manager.Rcon.Addr == "" {
+			return fmt.Errorf("manager.rcon.addr: must not be empty")
+		}
+		if s.Manager.Rcon.Interval <= 0 {
+			return fmt.Errorf("manager.rcon.interval: must be positive")
+		}
+	case ManagerDocker:
+		if s.Manager.Docker.Socket == "" {
+			return fmt.Errorf("manager.docker.socket: must not be empty")
+		}
+		if s.Manager.Docker.Container == "" {
+			return fmt.Errorf("manager.docker.container: must not be empty")
+		}
+		if s.Manager.Docker.Interval <= 0 {
+			return fmt.Errorf("manager.docker.interval: must be positive")
+		}
+	case ManagerRemote:
+		if s.Manager.Remote.Addr == "" {
+			return fmt.Errorf("manager.remote.addr: must not be empty")
+		}
+		if s.Manager.Remote.Token == "" {
+			return fmt.Errorf("manager.remote.token: must not be empty")
+		}
+		if s.Manager.Remote.Interval <= 0 {
+			return fmt.Errorf("manager.remote.interval: must be positive")
+		}
+	case ManagerKubernetes:
+		if s.Manager.Kubernetes.StatefulSet == "" {
+			return fmt.Errorf(
+				"manager.kubernetes.statefulSet: must not be empty",
+			)
+		}
+		if s.Manager.Kubernetes.Interval <= 0 {
+			return fmt.Errorf("manager.kubernetes.interval: must be positive")
+		}
+		if s.Manager.Rcon.Addr == "" {
+			return fmt.Errorf("manager.rcon.addr: must not be empty")
+		}
+		if s.Manager.Rcon.Password == "" {
+			return fmt.Errorf("manager.rcon.password: must not be empty")
+		}
+	default:
+		return fmt.Errorf("manager.type: unknown type %q", s.Manager.Type)
+	}
+
+	if s.Manager.Wol.MAC != "" {
+		_, err := net.ParseMAC(s.Manager.Wol.MAC)
+		switch {
+		case err != nil:
+			return fmt.Errorf("manager.wol.mac: %s", err)
+		case s.Manager.Wol.Broadcast == "":
+			return fmt.Errorf("manager.wol.broadcast: must not be empty")
+		case s.Manager.Wol.Host == "":
+			return fmt.Errorf("manager.wol.host: must not be empty")
+		case s.Manager.Wol.Interval <= 0:
+			return fmt.Errorf("manager.wol.interval: must be positive")
+		case s.Manager.Wol.Timeout <= 0:
+			return fmt.Errorf("manager.wol.timeout: must be positive")
+		}
+	}
+
+	switch s.Manager.Ready.Type {
+	case ReadyConsole:
+		_, err := regexp.Compile(s.Manager.Ready.Pattern)
+		if err != nil {
+			return fmt.Errorf("manager.ready.pattern: %s", err)
+		}
+	case ReadyTCP, ReadyStatus:
+		if s.Manager.Ready.Interval <= 0 {
+			return fmt.Errorf("manager.ready.interval: must be positive")
+		}
+	default:
+		return fmt.Errorf(
+			"manager.ready.type: unknown type %q",
+			s.Manager.Ready.Type,
+		)
+	}
+	if s.Manager.StartTimeout < 0 {
+		return fmt.Errorf("manager.startTimeout: must not be negative")
+	}
+
+	positive := map[string]Duration{
+		"stop.saveTimeout":   s.Manager.Stop.SaveTimeout,
+		"stop.timeout":       s.Manager.Stop.Timeout,
+		"stop.termTimeout":   s.Manager.Stop.TermTimeout,
+		"stop.deadline":      s.Manager.Stop.Deadline,
+		"restart.backoff":    s.Manager.Restart.Backoff,
+		"restart.maxBackoff": s.Manager.Restart.MaxBackoff,
+	}
+	for _, key := range sortedKeys(positive) {
+		if positive[key] <= 0 {
+			return fmt.Errorf("manager.%s: must be positive", key)
+		}
+	}
+	switch {
+	case s.Manager.Restart.MaxAttempts < 0:
+		return fmt.Errorf("manager.restart.maxAttempts: must not be negative")
+	case s.Manager.Restart.ResetAfter < 0:
+		return fmt.Errorf("manager.restart.resetAfter: must not be negative")
+	}
+
+	return nil
+
+}
+
+// placeholderPattern matches template placeholders such as {players}.
+var placeholderPattern = regexp.MustCompile(`\{[a-z]+\}`)
+
+// validateTemplate checks that a JSON template is a valid chat component.
+func validateTemplate(template string) error {
+	if !chat.IsJSON(template) {
+		return nil
+	}
+	_, err := chat.Parse(placeholderPattern.ReplaceAllString(template, "x"))
+	return err
+}
+
+// ServerNames returns the server names in sorted order.
+func (c *Config) ServerNames() []string {
+	names := make([]string, 0, len(c.Servers))
+	for name := range c.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys(m interface{}) []string {
+	value := reflect.ValueOf(m)
+	keys := make([]string, 0, value.Len())
+	for _, key := range value.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinKey joins a key and a subkey.
+func joinKey(key string, subkey string) string {
+	switch {
+	case key == "":
+		return keyOrRoot(subkey)
+	case subkey == "":
+		return key
+	}
+	return key + "." + subkey
+}
+
+// keyOrRoot names the top level key for errors.
+func keyOrRoot(key string) string {
+	if key == "" {
+		return "(root)"
+	}
+	return key
+}
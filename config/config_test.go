@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file and returns its path.
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "golem.json")
+	err := os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	path := writeConfig(t, `{
+		"listeners": [{"addr": ":25565", "default": "survival",
+			"routes": {"creative.example.com": "creative"}}],
+		"servers": {
+			"survival": {
+				"addr": "localhost:25566",
+				"manager": {"type": "process", "start": "java -jar s.jar",
+					"stop": {"timeout": "90s"}},
+				"idle": {"stopTimeout": 300}
+			},
+			"creative": {"addr": "localhost:25567"}
+		}
+	}`)
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	err = c.Validate()
+	if err != nil {
+		t.Fatalf("validate: %s", err)
+	}
+
+	// Set keys are decoded, missing keys are defaults
+	survival := c.Servers["survival"]
+	creative := c.Servers["creative"]
+	stop := survival.Manager.Stop
+	switch {
+	case len(c.Listeners) != 1 || c.Listeners[0].Default != "survival":
+		t.Errorf("got listeners %+v", c.Listeners)
+	case c.Listeners[0].Routes["creative.example.com"] != "creative":
+		t.Errorf("got routes %v", c.Listeners[0].Routes)
+	case survival.Manager.Type != ManagerProcess:
+		t.Errorf("got manager type %q", survival.Manager.Type)
+	case stop.Timeout.Duration() != 90*time.Second:
+		t.Errorf("got stop timeout %s", stop.Timeout.Duration())
+	case stop.Deadline != Seconds(120):
+		t.Errorf("got default stop deadline %s", stop.Deadline.Duration())
+	case survival.Idle.StopTimeout != Seconds(300):
+		t.Errorf("got idle timeout %s", survival.Idle.StopTimeout.Duration())
+	case creative.Manager.Type != ManagerBasic:
+		t.Errorf("got default manager type %q", creative.Manager.Type)
+	case c.Agent.Addr != ":25580":
+		t.Errorf("got default agent addr %q", c.Agent.Addr)
+	}
+
+	names := strings.Join(c.ServerNames(), " ")
+	if names != "creative survival" {
+		t.Errorf("got server names %s", names)
+	}
+
+}
+
+func TestLoadErrors(t *testing.T) {
+
+	tests := []struct {
+		data string
+		want string // error after the path
+	}{
+		{`{"listeners": [}`, "invalid character"},
+		{`{"debugg": true}`, "debugg: unknown key"},
+		{`{"listeners": [{"addr": ":1", "route": {}}]}`,
+			"listeners[0].route: unknown key"},
+		{`{"servers": {"mc": {"idle": {"stopTimeout": "5x"}}}}`,
+			`servers.mc.idle.stopTimeout: invalid duration "5x"`},
+		{`{"servers": {"mc": {"manager": {"stop": {"deadline": true}}}}}`,
+			"servers.mc.manager.stop.deadline: invalid duration true"},
+		{`{"servers": {"mc": {"status": {"playersMax": "20"}}}}`,
+			"servers.mc.status.playersMax: expected int but got string"},
+		{`{"debug": 1}`, "debug: expected bool but got number"},
+	}
+
+	for _, test := range tests {
+		path := writeConfig(t, test.data)
+		_, err := Load(path)
+		if err == nil {
+			t.Errorf("%s: got no error", test.data)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), path+": "+test.want) {
+			t.Errorf("%s: got error %q, want %q", test.data, err, test.want)
+		}
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		change func(c *Config, s *Server) // s is the default server
+		want   string                     // error, empty if valid
+	}{
+		{func(c *Config, s *Server) {}, ""},
+		{func(c *Config, s *Server) { c.Listeners = nil },
+			"listeners: must not be empty"},
+		{func(c *Config, s *Server) { c.Admin.Addr = ":8080" },
+			"admin.token: must not be empty"},
+		{func(c *Config, s *Server) { c.Listeners[0].Addr = "" },
+			"listeners[0].addr: must not be empty"},
+		{func(c *Config, s *Server) { c.Listeners[0].Default = "other" },
+			`listeners[0].default: unknown server "other"`},
+		{func(c *Config, s *Server) { c.Listeners[0].Routes["a.mc"] = "other" },
+			`listeners[0].routes.a.mc: unknown server "other"`},
+		{func(c *Config, s *Server) { s.Addr = "" },
+			"servers.default.addr: must not be empty"},
+		{func(c *Config, s *Server) { s.Idle.PauseTimeout = Seconds(60) },
+			"servers.default.idle.pauseTimeout: must be less than stopTimeout"},
+		{func(c *Config, s *Server) { s.Login.HoldTimeout = -1 },
+			"servers.default.login.holdTimeout: must not be negative"},
+		{func(c *Config, s *Server) { s.Messages.Stopped = `{"text": 1` },
+			"servers.default.messages.stopped: "},
+		{func(c *Config, s *Server) { s.Manager.Type = "vm" },
+			`servers.default.manager.type: unknown type "vm"`},
+		{func(c *Config, s *Server) { s.Manager.Type = ManagerProcess },
+			"servers.default.manager.start: must not be empty"},
+		{func(c *Config, s *Server) {
+			s.Manager.Type = ManagerDocker
+		}, "servers.default.manager.docker.container: must not be empty"},
+		{func(c *Config, s *Server) {
+			s.Manager.Type = ManagerRemote
+			s.Manager.Remote.Addr = "host:25580"
+		}, "servers.default.manager.remote.token: must not be empty"},
+		{func(c *Config, s *Server) {
+			s.Manager.Type = ManagerKubernetes
+			s.Manager.Kubernetes.StatefulSet = "mc"
+		}, "servers.default.manager.rcon.password: must not be empty"},
+		{func(c *Config, s *Server) { s.Manager.Wol.MAC = "x" },
+			"servers.default.manager.wol.mac: "},
+		{func(c *Config, s *Server) { s.Manager.Ready.Pattern = "(" },
+			"servers.default.manager.ready.pattern: "},
+		{func(c *Config, s *Server) { s.Manager.Stop.Deadline = 0 },
+			"servers.default.manager.stop.deadline: must be positive"},
+		{func(c *Config, s *Server) { s.Manager.Restart.MaxAttempts = -1 },
+			"servers.default.manager.restart.maxAttempts: must not be negative"},
+	}
+
+	for i, test := range tests {
+		c := Default()
+		test.change(c, c.Servers[DefaultServerName])
+		err := c.Validate()
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("test %d: unexpected error %q", i, err)
+		case test.want != "" && err == nil:
+			t.Errorf("test %d: got no error, want %q", i, test.want)
+		case test.want != "" && !strings.HasPrefix(err.Error(), test.want):
+			t.Errorf("test %d: got error %q, want %q", i, err, test.want)
+		}
+	}
+
+}
+
+func TestValidateAgent(t *testing.T) {
+
+	c := Default()
+	c.Listeners = nil
+	err := c.ValidateAgent()
+	if err == nil || err.Error() != "agent.token: must not be empty" {
+		t.Errorf("got error %v, want agent.token: must not be empty", err)
+	}
+
+	c.Agent.Token = "secret"
+	err = c.ValidateAgent()
+	if err != nil {
+		t.Errorf("unexpected error %q", err)
+	}
+
+}
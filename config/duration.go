@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// A Duration is a time.Duration decoded from either a duration string such
+// as "90s" or a number of seconds.
+type Duration time.Duration
+
+// Seconds returns a Duration of n seconds.
+func Seconds(n int) Duration {
+	return Duration(time.Duration(n) * time.Second)
+}
+
+// Duration returns the value as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+
+	var seconds float64
+	if json.Unmarshal(data, &seconds) == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	// Report errors as type errors so the decoder adds the key
+	typeErr := &json.UnmarshalTypeError{
+		Value: string(data),
+		Type:  reflect.TypeOf(d).Elem(),
+	}
+
+	var s string
+	if json.Unmarshal(data, &s) != nil {
+		return typeErr
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return typeErr
+	}
+
+	*d = Duration(v)
+	return nil
+
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+
+	tests := []struct {
+		data string
+		want time.Duration
+	}{
+		{`"90s"`, 90 * time.Second},
+		{`"1h30m"`, 90 * time.Minute},
+		{`"250ms"`, 250 * time.Millisecond},
+		{`60`, time.Minute},
+		{`1.5`, 1500 * time.Millisecond},
+		{`0`, 0},
+	}
+
+	for _, test := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(test.data), &d)
+		if err != nil || d.Duration() != test.want {
+			t.Errorf("%s: got %s, %v, want %s", test.data, d.Duration(),
+				err, test.want)
+		}
+	}
+
+}
+
+func TestDurationUnmarshalErrors(t *testing.T) {
+
+	for _, data := range []string{`"5x"`, `""`, `true`, `[]`, `{}`} {
+		var d Duration
+		err := json.Unmarshal([]byte(data), &d)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("%s: got %v, want type error", data, err)
+		}
+	}
+
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+
+	for _, d := range []Duration{0, Seconds(90), Duration(time.Millisecond)} {
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("marshal %s: %s", d.Duration(), err)
+		}
+		var got Duration
+		err = json.Unmarshal(data, &got)
+		if err != nil || got != d {
+			t.Errorf("%s: got %s, %v after %s", d.Duration(),
+				got.Duration(), err, data)
+		}
+	}
+
+	data, _ := json.Marshal(Seconds(90))
+	if string(data) != `"1m30s"` {
+		t.Errorf("marshal: got %s, want \"1m30s\"", data)
+	}
+
+}
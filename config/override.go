@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// OverrideKeys are the keys that can be set by Set, named as the command line
+// flags.
+var OverrideKeys = []string{
+	"debug",
+	"proxyAddr",
+	"serverAddr",
+	"serverStart",
+	"serverDirectory",
+	"stopTimeout",
+	"versionName",
+	"versionProtocol",
+	"playersMax",
+}
+
+// Set overrides a configuration value by key, as given by a command line flag
+// or environment variable. Proxy keys apply to the first listener and server
+// keys apply to its default server.
+func (c *Config) Set(key string, value string) error {
+
+	if key == "debug" {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected bool but got %q", key, value)
+		}
+		c.Debug = v
+		return nil
+	}
+
+	if len(c.Listeners) == 0 {
+		c.Listeners = []*Listener{defaultListener()}
+	}
+	l := c.Listeners[0]
+
+	if key == "proxyAddr" {
+		l.Addr = value
+		return nil
+	}
+
+	// Find the default server to override
+	if l.Default == "" {
+		return fmt.Errorf("%s: listeners[0] has no default server", key)
+	}
+	s := c.Servers[l.Default]
+	if s == nil {
+		return fmt.Errorf("%s: unknown server %q", key, l.Default)
+	}
+
+	switch key {
+	case "serverAddr":
+		s.Addr = value
+	case "serverStart":
+		// Empty disables autostart/stop
+		s.Manager.Start = value
+		if value == "" {
+			s.Manager.Type = ManagerBasic
+		} else if s.Manager.Type == ManagerBasic {
+			s.Manager.Type = ManagerProcess
+		}
+	case "serverDirectory":
+		s.Manager.Directory = value
+	case "stopTimeout":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected seconds but got %q", key, value)
+		}
+		s.Idle.StopTimeout = Seconds(v)
+	case "versionName":
+		s.Status.VersionName = value
+	case "versionProtocol":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected int but got %q", key, value)
+		}
+		s.Status.VersionProtocol = v
+	case "playersMax":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected int but got %q", key, value)
+		}
+		s.Status.PlayersMax = v
+	default:
+		return fmt.Errorf("%s: unknown key", key)
+	}
+
+	return nil
+
+}
+
+// Override sets each key from its environment variable found by lookupEnv,
+// such as os.LookupEnv, then from flags by key, so flags take precedence over
+// the environment, which takes precedence over the file.
+func (c *Config) Override(
+	lookupEnv func(string) (string, bool),
+	flags map[string]string,
+) error {
+
+	for _, key := range OverrideKeys {
+		value, ok := lookupEnv(EnvName(key))
+		if !ok {
+			continue
+		}
+		err := c.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", EnvName(key), err)
+		}
+	}
+
+	for _, key := range OverrideKeys {
+		value, ok := flags[key]
+		if !ok {
+			continue
+		}
+		err := c.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("-%s: %s", key, err)
+		}
+	}
+
+	return nil
+
+}
+
+// EnvName returns the environment variable for a key, e.g. GOLEM_PROXY_ADDR
+// for proxyAddr.
+func EnvName(key string) string {
+	var b strings.Builder
+	b.WriteString("GOLEM_")
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+)
+
+// lookup returns a lookup function of environment variables.
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestOverride(t *testing.T) {
+
+	c := Default()
+	c.Servers[DefaultServerName].Status.VersionName = "file"
+
+	// Flags take precedence over the environment over the file
+	err := c.Override(
+		lookup(map[string]string{
+			"GOLEM_VERSION_NAME":  "env",
+			"GOLEM_SERVER_START":  "java -jar server.jar",
+			"GOLEM_STOP_TIMEOUT":  "30",
+			"GOLEM_PLAYERS_MAX":   "5",
+			"GOLEM_UNRELATED_KEY": "x",
+		}),
+		map[string]string{
+			"versionName": "flag",
+			"playersMax":  "10",
+		},
+	)
+	if err != nil {
+		t.Fatalf("override: %s", err)
+	}
+
+	s := c.Servers[DefaultServerName]
+	switch {
+	case s.Status.VersionName != "flag":
+		t.Errorf("got version name %q, want flag", s.Status.VersionName)
+	case s.Status.PlayersMax != 10:
+		t.Errorf("got players max %d, want 10", s.Status.PlayersMax)
+	case s.Idle.StopTimeout != Seconds(30):
+		t.Errorf("got stop timeout %s", s.Idle.StopTimeout.Duration())
+	case s.Manager.Type != ManagerProcess:
+		t.Errorf("got manager type %q, want process", s.Manager.Type)
+	}
+
+	// An empty start command disables autostart/stop
+	err = c.Override(lookup(nil), map[string]string{"serverStart": ""})
+	if err != nil || s.Manager.Type != ManagerBasic {
+		t.Errorf("empty start: got %q, %v", s.Manager.Type, err)
+	}
+
+}
+
+func TestOverrideErrors(t *testing.T) {
+
+	tests := []struct {
+		env   map[string]string
+		flags map[string]string
+		want  string
+	}{
+		{map[string]string{"GOLEM_DEBUG": "yes"}, nil,
+			`GOLEM_DEBUG: debug: expected bool but got "yes"`},
+		{nil, map[string]string{"stopTimeout": "1m"},
+			`-stopTimeout: stopTimeout: expected seconds but got "1m"`},
+		{nil, map[string]string{"versionProtocol": "x"},
+			`-versionProtocol: versionProtocol: expected int but got "x"`},
+	}
+
+	for _, test := range tests {
+		err := Default().Override(lookup(test.env), test.flags)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("got error %v, want %s", err, test.want)
+		}
+	}
+
+}
+
+func TestSetWithoutDefaultServer(t *testing.T) {
+
+	c := Default()
+	c.Listeners[0].Default = ""
+
+	err := c.Set("proxyAddr", ":25567")
+	if err != nil || c.Listeners[0].Addr != ":25567" {
+		t.Errorf("proxy addr: got %q, %v", c.Listeners[0].Addr, err)
+	}
+	err = c.Set("serverAddr", ":25568")
+	want := "serverAddr: listeners[0] has no default server"
+	if err == nil || err.Error() != want {
+		t.Errorf("server addr: got %v, want %s", err, want)
+	}
+	err = c.Set("motd", "x")
+	if err == nil {
+		t.Error("unknown key: got no error")
+	}
+
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"debug":           "GOLEM_DEBUG",
+		"proxyAddr":       "GOLEM_PROXY_ADDR",
+		"versionProtocol": "GOLEM_VERSION_PROTOCOL",
+	}
+	for key, want := range tests {
+		if got := EnvName(key); got != want {
+			t.Errorf("%s: got %s, want %s", key, got, want)
+		}
+	}
+}
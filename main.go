@@ -6,101 +6,127 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
-	"time"
 
-	proxyPkg "golem/proxy"
-	serverPkg "golem/server"
-	"golem/server/process"
+	"golem/admin"
+	"golem/config"
 )
 
 func main() {
 
-	var proxyAddr string
-	var serverAddr string
-	var serverStart string
-	var serverDirectory string
-	var stopTimeout int
-	var versionName string
-	var versionProtocol int
-	var playersMax int
-	var debug bool
+	// Serve servers to remote proxies instead
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent(os.Args[2:])
+		return
+	}
+
+	var configPath string
 
 	// Define flags
-	flag.StringVar(&proxyAddr, "proxyAddr", ":25565",
+	// Flags other than config override the config file
+	flag.StringVar(&configPath, "config", os.Getenv("GOLEM_CONFIG"),
+		"Config file (JSON). Empty uses the flags only")
+	flag.String("proxyAddr", ":25565",
 		"Proxy server address")
-	flag.StringVar(&serverAddr, "serverAddr", ":25566",
+	flag.String("serverAddr", ":25566",
 		"Minecraft server address")
-	flag.StringVar(&serverStart, "serverStart", "",
+	flag.String("serverStart", "",
 		"Minecraft start command. Empty disables autostart/stop")
-	flag.StringVar(&serverDirectory, "serverDirectory", "",
+	flag.String("serverDirectory", "",
 		"Minecraft server working directory")
-	flag.IntVar(&stopTimeout, "stopTimeout", 60,
+	flag.Int("stopTimeout", 60,
 		"Wait period to stop server after last disconnect (seconds)")
-	flag.StringVar(&versionName, "versionName", "1.17.1",
+	flag.String("versionName", "1.17.1",
 		"Minecraft version name")
-	flag.IntVar(&versionProtocol, "versionProtocol", 756,
+	flag.Int("versionProtocol", 756,
 		"Minecraft protocol version")
-	flag.IntVar(&playersMax, "playersMax", 20,
+	flag.Int("playersMax", 20,
 		"Maximum number of players (to display in status message)")
-	flag.BoolVar(&debug, "debug", false,
+	flag.Bool("debug", false,
 		"Log all traffic")
 	flag.Parse()
 
-	// Create server depending on if server start command was given
-	var server serverPkg.Server
-	var timeDuration *time.Duration
-	if serverStart == "" {
-		server = serverPkg.NewBasicServer()
-	} else {
-		server = process.NewProcessServer(
-			newLogger("[server] "),
-			strings.Fields(serverStart),
-			serverDirectory,
-		)
-
-		// Make time duration reference
-		d := time.Duration(stopTimeout) * time.Second
-		timeDuration = &d
-	}
-
-	// Make optional packet logger
-	var protocolLogger *log.Logger
-	if debug {
-		protocolLogger = newLogger("[protocol] ")
+	// Load config
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("error loading config: %s\n", err)
+		os.Exit(1)
 	}
 
-	// Make proxy
-	proxy := proxyPkg.NewProxy(
-		newLogger("[proxy] "),
-		proxyAddr,
-		serverAddr,
-		timeDuration,
-		server,
-		protocolLogger,
-		versionName,
-		versionProtocol,
-		playersMax,
-	)
+	// Make servers and proxies
+	a := newApp(newLogger("[golem] "), configPath, cfg, newServer)
 
+	// Listen for SIGHUP and reload config
 	// Listen for SIGINT or SIGTERM and safely exit
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		<-c
-		server.Stop()
-		os.Exit(1)
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				err := a.Reload()
+				if err != nil {
+					a.logger.Printf("error reloading config: %s\n", err)
+				}
+				continue
+			}
+			a.Stop()
+			os.Exit(1)
+		}
 	}()
 
-	// Run proxy
-	err := proxy.Run()
+	// Run optional admin API
+	if cfg.Admin.Addr != "" {
+		api := admin.NewAPI(
+			newLogger("[admin] "),
+			cfg.Admin.Token,
+			a.Routes,
+			a.Reload,
+		)
+		go func() {
+			err := api.ListenAndServe(cfg.Admin.Addr)
+			a.logger.Printf("error running admin api: %s\n", err)
+		}()
+	}
+
+	// Run proxies
+	err = a.Run()
 	if err != nil {
 		fmt.Printf("error starting proxy: %s\n", err)
 	}
 
 }
 
+// loadConfig loads the config file, or the default config if path is
+// empty, then applies environment variables and flags and validates.
+func loadConfig(path string) (*config.Config, error) {
+
+	var cfg *config.Config
+	var err error
+	if path == "" {
+		cfg = config.Default()
+	} else {
+		cfg, err = config.Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Override with environment variables, then flags
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	err = cfg.Override(os.LookupEnv, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+
+}
+
 // newLogger makes a new logger to stdout.
 func newLogger(prefix string) *log.Logger {
 	return log.New(os.Stdout, prefix, 0)
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// A Component is a JSON chat component with text, formatting and children.
+type Component struct {
+	Text          string      `json:"text"`
+	Color         string      `json:"color,omitempty"`
+	Bold          bool        `json:"bold,omitempty"`
+	Italic        bool        `json:"italic,omitempty"`
+	Underlined    bool        `json:"underlined,omitempty"`
+	Strikethrough bool        `json:"strikethrough,omitempty"`
+	Obfuscated    bool        `json:"obfuscated,omitempty"`
+	Extra         []Component `json:"extra,omitempty"`
+}
+
+// LegacyCode is the prefix of legacy formatting codes.
+const LegacyCode = '§'
+
+// legacyColors are the color names of legacy color codes.
+var legacyColors = map[rune]string{
+	'0': "black",
+	'1': "dark_blue",
+	'2': "dark_green",
+	'3': "dark_aqua",
+	'4': "dark_red",
+	'5': "dark_purple",
+	'6': "gold",
+	'7': "gray",
+	'8': "dark_gray",
+	'9': "blue",
+	'a': "green",
+	'b': "aqua",
+	'c': "red",
+	'd': "light_purple",
+	'e': "yellow",
+	'f': "white",
+}
+
+// IsJSON returns if a message is a JSON chat component, an object or array,
+// rather than text. Text such as "{state}" or "[running]" is not JSON.
+func IsJSON(message string) bool {
+
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return false
+	}
+
+	rest := strings.TrimSpace(message[1:])
+	switch message[0] {
+	case '{':
+		return strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "}")
+	case '[':
+		return rest != "" && strings.ContainsRune(`{["]`, rune(rest[0]))
+	}
+	return false
+
+}
+
+// Parse parses a message into a JSON chat component. A message is either a
+// JSON chat component, kept as is, or text with legacy formatting codes.
+func Parse(message string) (json.RawMessage, error) {
+
+	if IsJSON(message) {
+		raw := json.RawMessage(strings.TrimSpace(message))
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("invalid chat component: %s", message)
+		}
+		return raw, nil
+	}
+
+	return json.Marshal(Legacy(message))
+
+}
+
+// Legacy converts text with legacy formatting codes, such as "§cred §lbold",
+// into a chat component.
+func Legacy(text string) Component {
+
+	if !strings.ContainsRune(text, LegacyCode) {
+		return Component{Text: text}
+	}
+
+	var parts []Component
+	var current Component
+	var b strings.Builder
+
+	// flush appends the text so far with the current formatting
+	flush := func() {
+		if b.Len() == 0 {
+			return
+		}
+		current.Text = b.String()
+		parts = append(parts, current)
+		b.Reset()
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+
+		if runes[i] != LegacyCode || i+1 == len(runes) {
+			b.WriteRune(runes[i])
+			continue
+		}
+
+		code := []rune(strings.ToLower(string(runes[i+1])))[0]
+		i++
+		flush()
+
+		// Colors and reset clear the formatting
+		if color, ok := legacyColors[code]; ok {
+			current = Component{Color: color}
+			continue
+		}
+		switch code {
+		case 'k':
+			current.Obfuscated = true
+		case 'l':
+			current.Bold = true
+		case 'm':
+			current.Strikethrough = true
+		case 'n':
+			current.Underlined = true
+		case 'o':
+			current.Italic = true
+		case 'r':
+			current = Component{}
+		default:
+			// Keep unknown codes as text
+			b.WriteRune(LegacyCode)
+			b.WriteRune(runes[i])
+		}
+
+	}
+	flush()
+
+	return Component{Extra: parts}
+
+}
@@ -2,8 +2,10 @@ package protocol
 
 import (
 	"encoding/json"
+	"io"
 	"log"
 	"net"
+	"time"
 
 	"golem/protocol/protocol"
 )
@@ -44,13 +46,48 @@ func (c ClientConn) ReadStatusRequestPacket() (protocol.StatusRequestPacket, err
 	return p, err
 }
 
-// ReadLoginStartPacket reads a login start packet.
-func (c ClientConn) ReadLoginStartPacket() (protocol.LoginStartPacket, error) {
+// ReadLoginStartPacket reads a login start packet of a protocol version,
+// which decides if it has the player UUID.
+func (c *ClientConn) ReadLoginStartPacket(
+	protocolVersion int,
+) (protocol.LoginStartPacket, error) {
+
 	var p protocol.LoginStartPacket
-	err := c.readPacket(&p, protocol.LoginStartPacketID)
+
+	r, data, err := readPacket(c, protocol.LoginStartPacketID)
+	if err != nil {
+		return p, err
+	}
+
+	err = decodePacket(&p, r, data)
+	if err != nil {
+		return p, err
+	}
+
+	// A missing UUID is not an error, it is only informative
+	decodeLoginStartUUID(&p, r, protocolVersion)
+	return p, nil
+
+}
+
+// ReadStatusResponsePacket reads a status response packet.
+func (c ClientConn) ReadStatusResponsePacket() (protocol.StatusResponsePacket, error) {
+	var p protocol.StatusResponsePacket
+	err := c.readPacket(&p, protocol.StatusResponsePacketID)
 	return p, err
 }
 
+// WriteHandshakePacket writes a handshake packet.
+func (c *ClientConn) WriteHandshakePacket(p protocol.HandshakePacket) error {
+	return c.writePacket(&p, protocol.HandshakePacketID)
+}
+
+// WriteStatusRequestPacket writes a status request packet.
+func (c *ClientConn) WriteStatusRequestPacket() error {
+	p := protocol.StatusRequestPacket{}
+	return c.writePacket(&p, protocol.StatusRequestPacketID)
+}
+
 // ReadAndRespondPing reads a ping packet and sends a pong.
 func (c *ClientConn) ReadAndRespondPing() error {
 
@@ -66,52 +103,70 @@ func (c *ClientConn) ReadAndRespondPing() error {
 
 // WriteMessageStatus sends a status message.
 func (c *ClientConn) WriteMessageStatus(
-	text string,
+	description json.RawMessage,
 	versionName string,
 	versionProtocol int,
 	playersOnline int,
 	playersMax int,
+	playerSample []protocol.PlayerSample,
+	favicon string,
 ) error {
 
-	serverStatus := protocol.ServerStatus{
-		protocol.Version{
-			versionName,
-			versionProtocol,
+	return c.WriteServerStatus(protocol.ServerStatus{
+		Version: protocol.Version{
+			Name:     versionName,
+			Protocol: versionProtocol,
 		},
-		protocol.Players{
-			playersMax,
-			playersOnline,
-			[]protocol.PlayerSample{},
+		Players: protocol.Players{
+			Max:    playersMax,
+			Online: playersOnline,
+			Sample: playerSample,
 		},
-		protocol.Description{text},
-		"",
-	}
+		Description: description,
+		Favicon:     favicon,
+	})
+
+}
+
+// WriteServerStatus sends a status message from a server status.
+func (c *ClientConn) WriteServerStatus(serverStatus protocol.ServerStatus) error {
 
 	bytes, err := json.Marshal(serverStatus)
 	if err != nil {
 		return err
 	}
 
-	p := protocol.StatusResponsePacket{string(bytes)}
-	return c.writePacket(&p, protocol.StatusResponsePacketID)
+	return c.WriteStatus(string(bytes))
 
 }
 
+// WriteStatus sends a status message from its JSON, such as one relayed from
+// a server.
+func (c *ClientConn) WriteStatus(status string) error {
+	p := protocol.StatusResponsePacket{StatusResponse: status}
+	return c.writePacket(&p, protocol.StatusResponsePacketID)
+}
+
 // WriteMessageText sends a text message.
 func (c *ClientConn) WriteMessageText(text string) error {
 
-	serverText := protocol.ServerText{text}
+	serverText := protocol.ServerText{Text: text}
 
 	bytes, err := json.Marshal(serverText)
 	if err != nil {
 		return err
 	}
 
-	p := protocol.StatusResponsePacket{string(bytes)}
-	return c.writePacket(&p, protocol.StatusResponsePacketID)
+	return c.WriteMessage(bytes)
 
 }
 
+// WriteMessage sends a chat component message.
+func (c *ClientConn) WriteMessage(message json.RawMessage) error {
+	p := protocol.StatusResponsePacket{StatusResponse: string(message)}
+	return c.writePacket(&p, protocol.StatusResponsePacketID)
+}
+
 // Read implements the io.Reader interface.
 func (c *ClientConn) Read(p []byte) (int, error) {
 	n, err := c.conn.Read(p)
@@ -127,10 +182,10 @@ func (c *ClientConn) ReadByte() (byte, error) {
 	return b[0], err
 }
 
-// ReadN implements the BytesReader interface.
+// ReadBytes implements the BytesReader interface.
 func (c *ClientConn) ReadBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
-	_, err := c.Read(b)
+	_, err := io.ReadFull(c, b)
 	return b, err
 }
 
@@ -143,6 +198,16 @@ func (c *ClientConn) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// RemoteAddr returns the remote address of the connection.
+func (c *ClientConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadline of the connection.
+func (c *ClientConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
 // Close implements the io.Closer interface.
 func (c *ClientConn) Close() error {
 	return c.conn.Close()
@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golem/protocol/nbt"
+	"golem/protocol/protocol"
+	"golem/protocol/types"
+)
+
+// limboWorld is the name of the empty world players join in limbo.
+const limboWorld = "golem:limbo"
+
+// limboDimensionType is the dimension type of the limbo world, an overworld
+// with the sky of the end.
+var limboDimensionType = nbt.Compound{
+	{Name: "piglin_safe", Value: int8(0)},
+	{Name: "natural", Value: int8(0)},
+	{Name: "ambient_light", Value: float32(0)},
+	{Name: "infiniburn", Value: "minecraft:infiniburn_overworld"},
+	{Name: "respawn_anchor_works", Value: int8(0)},
+	{Name: "has_skylight", Value: int8(0)},
+	{Name: "bed_works", Value: int8(0)},
+	{Name: "effects", Value: "minecraft:the_end"},
+	{Name: "has_raids", Value: int8(0)},
+	{Name: "min_y", Value: int32(0)},
+	{Name: "height", Value: int32(256)},
+	{Name: "logical_height", Value: int32(256)},
+	{Name: "coordinate_scale", Value: float64(1)},
+	{Name: "ultrawarm", Value: int8(0)},
+	{Name: "has_ceiling", Value: int8(0)},
+}
+
+// limboBiome is the only biome of the limbo world.
+var limboBiome = nbt.Compound{
+	{Name: "precipitation", Value: "none"},
+	{Name: "depth", Value: float32(0.125)},
+	{Name: "temperature", Value: float32(0.8)},
+	{Name: "scale", Value: float32(0.05)},
+	{Name: "downfall", Value: float32(0.4)},
+	{Name: "category", Value: "none"},
+	{Name: "effects", Value: nbt.Compound{
+		{Name: "sky_color", Value: int32(0)},
+		{Name: "water_fog_color", Value: int32(329011)},
+		{Name: "fog_color", Value: int32(0)},
+		{Name: "water_color", Value: int32(4159204)},
+	}},
+}
+
+// limboDimensionCodec is the registry of dimension types and biomes sent in
+// the 1.17 join game packet.
+var limboDimensionCodec = nbt.Compound{
+	{Name: "minecraft:dimension_type", Value: nbt.Compound{
+		{Name: "type", Value: "minecraft:dimension_type"},
+		{Name: "value", Value: nbt.List{nbt.Compound{
+			{Name: "name", Value: limboWorld},
+			{Name: "id", Value: int32(0)},
+			{Name: "element", Value: limboDimensionType},
+		}}},
+	}},
+	{Name: "minecraft:worldgen/biome", Value: nbt.Compound{
+		{Name: "type", Value: "minecraft:worldgen/biome"},
+		{Name: "value", Value: nbt.List{nbt.Compound{
+			{Name: "name", Value: "minecraft:plains"},
+			{Name: "id", Value: int32(0)},
+			{Name: "element", Value: limboBiome},
+		}}},
+	}},
+}
+
+// LimboPlay returns if a protocol version can join the limbo world.
+func LimboPlay(protocolVersion int) bool {
+	return protocolVersion >= protocol.Play117MinVersion &&
+		protocolVersion <= protocol.Play117MaxVersion
+}
+
+// LimboTransfer returns if a protocol version can wait in the configuration
+// state and be transferred.
+func LimboTransfer(protocolVersion int) bool {
+	return protocolVersion >= protocol.TransferMinVersion &&
+		protocolVersion <= protocol.TransferMaxVersion
+}
+
+// WriteLoginSuccessPacket finishes the login of a protocol version. From
+// 1.20.2 the client acknowledges and enters the configuration state.
+func (c *ClientConn) WriteLoginSuccessPacket(
+	p protocol.LoginSuccessPacket,
+	protocolVersion int,
+) error {
+
+	data, err := encodePacket(&p)
+	if err != nil {
+		return err
+	}
+
+	// No properties, and no strict error handling
+	if protocolVersion >= protocol.LoginSuccessStrictVersion {
+		data = append(data, types.VarInt(0).Encode()...)
+	}
+	if protocolVersion >= protocol.LoginSuccessStrictVersion &&
+		protocolVersion < protocol.LoginSuccessNoStrictVersion {
+		data = append(data, types.Boolean(false).Encode()...)
+	}
+
+	err = writePacket(c, protocol.LoginSuccessPacketID, data)
+	if err != nil {
+		return err
+	}
+
+	if protocolVersion < protocol.LoginAcknowledgedVersion {
+		return nil
+	}
+	_, _, err = readPacket(c, protocol.LoginAcknowledgedPacketID)
+	return err
+
+}
+
+// WriteLimboJoin joins the player to the empty limbo world in spectator
+// mode, on protocol versions where LimboPlay.
+func (c *ClientConn) WriteLimboJoin() error {
+
+	codec, err := nbt.Marshal("", limboDimensionCodec)
+	if err != nil {
+		return err
+	}
+	dimension, err := nbt.Marshal("", limboDimensionType)
+	if err != nil {
+		return err
+	}
+
+	err = c.writePacket(&protocol.JoinGamePacket{
+		EntityID:         1,
+		GameMode:         protocol.GameModeSpectator,
+		PreviousGameMode: protocol.GameModeNone,
+		WorldNames:       []string{limboWorld},
+		DimensionCodec:   codec,
+		Dimension:        dimension,
+		WorldName:        limboWorld,
+		MaxPlayers:       1,
+		ViewDistance:     2,
+	}, protocol.Play117JoinGamePacketID)
+	if err != nil {
+		return err
+	}
+
+	// The position closes the loading screen
+	return c.writePacket(&protocol.PlayerPositionPacket{
+		Y: 64,
+	}, protocol.Play117PlayerPositionPacketID)
+
+}
+
+// WriteLimboTitle shows a title until the player leaves the limbo world.
+func (c *ClientConn) WriteLimboTitle(message json.RawMessage) error {
+
+	err := c.writePacket(&protocol.TitleTimesPacket{
+		FadeIn:  10,
+		Stay:    72000,
+		FadeOut: 10,
+	}, protocol.Play117TitleTimesPacketID)
+	if err != nil {
+		return err
+	}
+
+	p := protocol.ChatPacket{Message: string(message)}
+	return c.writePacket(&p, protocol.Play117TitleTextPacketID)
+
+}
+
+// WriteLimboActionBar shows a message above the hotbar for a few seconds.
+func (c *ClientConn) WriteLimboActionBar(message json.RawMessage) error {
+	p := protocol.ChatPacket{Message: string(message)}
+	return c.writePacket(&p, protocol.Play117ActionBarPacketID)
+}
+
+// WriteLimboKeepAlive keeps a player in limbo from timing out.
+func (c *ClientConn) WriteLimboKeepAlive(id int64, protocolVersion int) error {
+	p := protocol.KeepAlivePacket{ID: id}
+	if LimboTransfer(protocolVersion) {
+		return c.writePacket(&p, protocol.ConfigurationKeepAlivePacketID)
+	}
+	return c.writePacket(&p, protocol.Play117KeepAliveClientPacketID)
+}
+
+// WriteLimboDisconnect disconnects a player in limbo with a chat component
+// message.
+func (c *ClientConn) WriteLimboDisconnect(
+	message json.RawMessage,
+	protocolVersion int,
+) error {
+
+	if !LimboTransfer(protocolVersion) {
+		p := protocol.ChatPacket{Message: string(message)}
+		return c.writePacket(&p, protocol.Play117DisconnectPacketID)
+	}
+
+	// Chat components are NBT from 1.20.3
+	v, err := nbt.FromJSON(message)
+	if err != nil {
+		return err
+	}
+	reason, err := nbt.MarshalNetwork(v)
+	if err != nil {
+		return err
+	}
+	p := protocol.ConfigurationDisconnectPacket{Reason: reason}
+	return c.writePacket(&p, protocol.ConfigurationDisconnectPacketID)
+
+}
+
+// WriteTransferPacket transfers a player in limbo to a server address, on
+// protocol versions where LimboTransfer.
+func (c *ClientConn) WriteTransferPacket(host string, port int) error {
+	p := protocol.TransferPacket{Host: host, Port: port}
+	return c.writePacket(&p, protocol.ConfigurationTransferPacketID)
+}
+
+// DiscardPackets reads and discards packets until an error, such as the
+// client disconnecting.
+func (c *ClientConn) DiscardPackets() error {
+
+	for {
+
+		var packetLength types.VarInt
+		err := packetLength.Decode(c)
+		if err != nil {
+			return err
+		}
+		if packetLength < 1 || packetLength > maxPacketLength {
+			return fmt.Errorf("invalid packet length %d", packetLength)
+		}
+
+		_, err = c.ReadBytes(int(packetLength))
+		if err != nil {
+			return err
+		}
+
+	}
+
+}
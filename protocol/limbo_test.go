@@ -0,0 +1,256 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"golem/protocol/nbt"
+	"golem/protocol/protocol"
+	"golem/protocol/types"
+)
+
+// decodeHex decodes hex bytes separated by spaces.
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// written returns the bytes written to a ClientConn, whose client replies
+// with bytes.
+func written(
+	t *testing.T,
+	reply []byte,
+	write func(c *ClientConn) error,
+) []byte {
+
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+
+	// Read everything until the server end closes
+	data := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(client)
+		data <- b
+	}()
+	if len(reply) > 0 {
+		go client.Write(reply)
+	}
+
+	err := write(NewClientConn(server, nil))
+	server.Close()
+	if err != nil {
+		t.Fatalf("writing: %s", err)
+	}
+	return <-data
+
+}
+
+// checkBytes fails a test if the bytes written differ.
+func checkBytes(t *testing.T, name string, got []byte, want []byte) {
+	t.Helper()
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s:\ngot  % x\nwant % x", name, got, want)
+	}
+}
+
+func TestLimboVersions(t *testing.T) {
+
+	tests := []struct {
+		protocolVersion int
+		play            bool
+		transfer        bool
+	}{
+		{754, false, false}, // 1.16.5
+		{755, true, false},  // 1.17
+		{756, true, false},  // 1.17.1
+		{757, false, false}, // 1.18
+		{765, false, false}, // 1.20.3
+		{766, false, true},  // 1.20.5
+		{767, false, true},  // 1.21
+		{768, false, true},  // 1.21.2
+		{769, false, true},  // 1.21.4
+		{770, false, false}, // 1.21.5
+	}
+
+	for _, test := range tests {
+		play := LimboPlay(test.protocolVersion)
+		transfer := LimboTransfer(test.protocolVersion)
+		if play != test.play || transfer != test.transfer {
+			t.Errorf("version %d: got play %t and transfer %t",
+				test.protocolVersion, play, transfer)
+		}
+	}
+
+}
+
+func TestWriteLoginSuccessPacket(t *testing.T) {
+
+	// Length, packet id, UUID and name
+	uuid := "00112233445566778899aabbccddeeff"
+	header := "02 " + uuid + " 05 5374657665"
+	acknowledged := decodeHex(t, "01 03")
+
+	tests := []struct {
+		protocolVersion int
+		want            string
+	}{
+		{756, "17 " + header},
+		{764, "17 " + header},
+		{765, "17 " + header},
+		{766, "19 " + header + " 00 00"}, // properties, strict
+		{767, "19 " + header + " 00 00"},
+		{768, "18 " + header + " 00"}, // properties
+		{769, "18 " + header + " 00"},
+	}
+
+	for _, test := range tests {
+
+		var p protocol.LoginSuccessPacket
+		copy(p.PlayerUUID[:], decodeHex(t, uuid))
+		p.Username = "Steve"
+
+		// The login is acknowledged from 1.20.2
+		var reply []byte
+		if test.protocolVersion >= protocol.LoginAcknowledgedVersion {
+			reply = acknowledged
+		}
+
+		got := written(t, reply, func(c *ClientConn) error {
+			return c.WriteLoginSuccessPacket(p, test.protocolVersion)
+		})
+		name := fmt.Sprintf("version %d", test.protocolVersion)
+		checkBytes(t, name, got, decodeHex(t, test.want))
+
+	}
+
+}
+
+func TestWriteLimboJoin(t *testing.T) {
+
+	codec, err := nbt.Marshal("", limboDimensionCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dimension, err := nbt.Marshal("", limboDimensionType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Join game: entity id, not hardcore, spectator, no previous game mode,
+	// the world names, codec, dimension and world name, then the seed, max
+	// players, view distance and four flags
+	world := "0b " + hex.EncodeToString([]byte(limboWorld))
+	join := decodeHex(t, "26 00000001 00 03 ff 01 "+world)
+	join = append(join, codec...)
+	join = append(join, dimension...)
+	join = append(join, decodeHex(t, world)...)
+	join = append(join, decodeHex(t, "0000000000000000 01 02 00000000")...)
+	want := append(types.VarInt(len(join)).Encode(), join...)
+
+	// Player position at y 64, no flags, teleport id 0, no dismount
+	want = append(want, decodeHex(t, "24 38 "+
+		"0000000000000000 4050000000000000 0000000000000000 "+
+		"00000000 00000000 00 00 00")...)
+
+	got := written(t, nil, func(c *ClientConn) error {
+		return c.WriteLimboJoin()
+	})
+	checkBytes(t, "join", got, want)
+
+}
+
+func TestLimboDimensionCodec(t *testing.T) {
+
+	codec, err := nbt.Marshal("", limboDimensionCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A root compound with the dimension type registry first
+	name := hex.EncodeToString([]byte("minecraft:dimension_type"))
+	want := decodeHex(t, "0a 0000 0a 0018 "+name)
+	if !bytes.HasPrefix(codec, want) {
+		t.Errorf("got codec starting % x", codec[:len(want)])
+	}
+	if codec[len(codec)-1] != 0 {
+		t.Errorf("got codec ending % x", codec[len(codec)-1])
+	}
+
+}
+
+func TestWriteLimboMessages(t *testing.T) {
+
+	message := json.RawMessage(`{"text":"hi"}`)
+	text := "0d " + hex.EncodeToString(message)
+
+	tests := []struct {
+		name  string
+		write func(c *ClientConn) error
+		want  string
+	}{
+		{
+			"title",
+			func(c *ClientConn) error { return c.WriteLimboTitle(message) },
+			// Fade in 10, stay 72000 and fade out 10 ticks, then the text
+			"0d 5a 0000000a 00011940 0000000a 0f 59 " + text,
+		},
+		{
+			"action bar",
+			func(c *ClientConn) error { return c.WriteLimboActionBar(message) },
+			"0f 41 " + text,
+		},
+		{
+			"play keep alive",
+			func(c *ClientConn) error {
+				return c.WriteLimboKeepAlive(0x0102030405060708, 756)
+			},
+			"09 21 0102030405060708",
+		},
+		{
+			"configuration keep alive",
+			func(c *ClientConn) error {
+				return c.WriteLimboKeepAlive(0x0102030405060708, 767)
+			},
+			"09 04 0102030405060708",
+		},
+		{
+			"play disconnect",
+			func(c *ClientConn) error {
+				return c.WriteLimboDisconnect(message, 756)
+			},
+			"0f 1a " + text,
+		},
+		{
+			"configuration disconnect",
+			func(c *ClientConn) error {
+				return c.WriteLimboDisconnect(message, 769)
+			},
+			// An unnamed compound with the string tag text
+			"0e 02 0a 08 0004 74657874 0002 6869 00",
+		},
+		{
+			"transfer",
+			func(c *ClientConn) error {
+				return c.WriteTransferPacket("mc.test", 25565)
+			},
+			"0c 0b 07 6d632e74657374 ddc701",
+		},
+	}
+
+	for _, test := range tests {
+		got := written(t, nil, test.write)
+		checkBytes(t, test.name, got, decodeHex(t, test.want))
+	}
+
+}
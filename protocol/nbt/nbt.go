@@ -0,0 +1,240 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Tag types
+const (
+	tagEnd      = byte(0)
+	tagByte     = byte(1)
+	tagShort    = byte(2)
+	tagInt      = byte(3)
+	tagLong     = byte(4)
+	tagFloat    = byte(5)
+	tagDouble   = byte(6)
+	tagString   = byte(8)
+	tagList     = byte(9)
+	tagCompound = byte(10)
+)
+
+// A Compound is a compound tag with its fields in order.
+type Compound []Field
+
+// A Field is a named tag in a compound. The value is one of int8, int16,
+// int32, int64, float32, float64, string, List or Compound.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// A List is a list tag of values of the same type.
+type List []interface{}
+
+// Marshal encodes a compound as a named root tag.
+func Marshal(name string, c Compound) ([]byte, error) {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteByte(tagCompound)
+	writeString(&buffer, name)
+	err := writePayload(&buffer, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+
+}
+
+// MarshalNetwork encodes a value as an unnamed root tag, as sent in packets
+// since 1.20.3.
+func MarshalNetwork(v interface{}) ([]byte, error) {
+
+	var buffer bytes.Buffer
+
+	t, err := tagType(v)
+	if err != nil {
+		return nil, err
+	}
+	buffer.WriteByte(t)
+	err = writePayload(&buffer, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+
+}
+
+// FromJSON converts JSON, such as a chat component, to a value. Objects are
+// compounds with sorted keys, booleans are bytes and whole numbers are ints.
+// Lists with mixed types wrap their elements in compounds with an empty key.
+func FromJSON(data []byte) (interface{}, error) {
+
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromJSON(v)
+
+}
+
+// fromJSON converts a decoded JSON value.
+func fromJSON(v interface{}) (interface{}, error) {
+
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), nil
+		}
+		return v, nil
+	case string:
+		return v, nil
+
+	case []interface{}:
+		list := List{}
+		mixed := false
+		for _, element := range v {
+			value, err := fromJSON(element)
+			if err != nil {
+				return nil, err
+			}
+			if len(list) > 0 {
+				a, _ := tagType(list[0])
+				b, _ := tagType(value)
+				mixed = mixed || a != b
+			}
+			list = append(list, value)
+		}
+		if mixed {
+			for i, value := range list {
+				list[i] = Compound{{Name: "", Value: value}}
+			}
+		}
+		return list, nil
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		compound := Compound{}
+		for _, key := range keys {
+			value, err := fromJSON(v[key])
+			if err != nil {
+				return nil, err
+			}
+			compound = append(compound, Field{Name: key, Value: value})
+		}
+		return compound, nil
+
+	}
+
+	return nil, fmt.Errorf("unsupported json value: %v", v)
+
+}
+
+// tagType returns the tag type of a value.
+func tagType(v interface{}) (byte, error) {
+	switch v.(type) {
+	case int8:
+		return tagByte, nil
+	case int16:
+		return tagShort, nil
+	case int32:
+		return tagInt, nil
+	case int64:
+		return tagLong, nil
+	case float32:
+		return tagFloat, nil
+	case float64:
+		return tagDouble, nil
+	case string:
+		return tagString, nil
+	case List:
+		return tagList, nil
+	case Compound:
+		return tagCompound, nil
+	}
+	return 0, fmt.Errorf("unknown nbt type: %T", v)
+}
+
+// writePayload writes the payload of a value.
+func writePayload(buffer *bytes.Buffer, v interface{}) error {
+
+	switch v := v.(type) {
+	case int8:
+		buffer.WriteByte(byte(v))
+	case int16:
+		binary.Write(buffer, binary.BigEndian, v)
+	case int32:
+		binary.Write(buffer, binary.BigEndian, v)
+	case int64:
+		binary.Write(buffer, binary.BigEndian, v)
+	case float32:
+		binary.Write(buffer, binary.BigEndian, math.Float32bits(v))
+	case float64:
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeString(buffer, v)
+
+	case List:
+		elementType := tagEnd
+		if len(v) > 0 {
+			var err error
+			elementType, err = tagType(v[0])
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(elementType)
+		binary.Write(buffer, binary.BigEndian, int32(len(v)))
+		for _, element := range v {
+			err := writePayload(buffer, element)
+			if err != nil {
+				return err
+			}
+		}
+
+	case Compound:
+		for _, field := range v {
+			t, err := tagType(field.Value)
+			if err != nil {
+				return err
+			}
+			buffer.WriteByte(t)
+			writeString(buffer, field.Name)
+			err = writePayload(buffer, field.Value)
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(tagEnd)
+
+	default:
+		return fmt.Errorf("unknown nbt type: %T", v)
+	}
+
+	return nil
+
+}
+
+// writeString writes a string with its unsigned short length.
+func writeString(buffer *bytes.Buffer, s string) {
+	binary.Write(buffer, binary.BigEndian, uint16(len(s)))
+	buffer.WriteString(s)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"reflect"
 
+	"golem/protocol/protocol"
 	"golem/protocol/types"
 )
 
@@ -13,6 +14,9 @@ const bufferSize = 1024
 
 const tagName = "protocol"
 
+// maxPacketLength is the largest packet length, the largest 3 byte VarInt.
+const maxPacketLength = 1<<21 - 1
+
 // readPacket reads and decodes a packet into a struct.
 // Returns an error if:
 // - the expected packet id differs from the packet id read,
@@ -67,6 +71,9 @@ func readPacket(
 		if err != nil {
 			return err
 		}
+		if packetLength < 1 || packetLength > maxPacketLength {
+			return fmt.Errorf("invalid packet length %d", packetLength)
+		}
 
 		data, err = r.ReadBytes(int(packetLength))
 		if err != nil {
@@ -135,6 +142,8 @@ func decodePacket(p interface{}, r io.ByteReader, data []byte) error {
 		tag := typeField.Tag.Get(tagName)
 
 		switch tag {
+		case "-":
+			continue
 		case "_data":
 			value = reflect.ValueOf(data)
 		case "Byte":
@@ -165,6 +174,38 @@ func decodePacket(p interface{}, r io.ByteReader, data []byte) error {
 
 }
 
+// decodeLoginStartUUID decodes the player UUID of a login start packet
+// depending on protocol version.
+func decodeLoginStartUUID(
+	p *protocol.LoginStartPacket,
+	r io.ByteReader,
+	protocolVersion int,
+) error {
+
+	if protocolVersion < protocol.LoginStartOptionalUUIDVersion {
+		return nil
+	}
+
+	if protocolVersion < protocol.LoginStartUUIDVersion {
+		var hasUUID types.Boolean
+		err := hasUUID.Decode(r)
+		if err != nil || !hasUUID {
+			return err
+		}
+	}
+
+	var u types.UUID
+	err := u.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	p.PlayerUUID = u
+	p.HasPlayerUUID = true
+	return nil
+
+}
+
 // encodePacket encodes a packet to a tagged struct using reflection.
 func encodePacket(p interface{}) ([]byte, error) {
 
@@ -184,14 +225,30 @@ func encodePacket(p interface{}) ([]byte, error) {
 		tag := typeField.Tag.Get(tagName)
 
 		switch tag {
-		case "_data":
+		case "-", "_data":
 			continue
+		case "Boolean":
+			encoder = types.Boolean(valueField.Bool())
 		case "Byte":
 			encoder = types.Byte(valueField.Int())
+		case "Double":
+			encoder = types.Double(valueField.Float())
+		case "Float":
+			encoder = types.Float(valueField.Float())
+		case "Int":
+			encoder = types.Int(valueField.Int())
+		case "Long":
+			encoder = types.Long(valueField.Int())
+		case "NBT":
+			encoder = types.Raw(valueField.Bytes())
 		case "String":
 			encoder = types.String(valueField.String())
-		// case "UnsignedShort":
-		// 	encoder = types.UnsignedShort(valueField.Int())
+		case "StringArray":
+			encoder = types.StringArray(valueField.Interface().([]string))
+		case "UnsignedShort":
+			encoder = types.UnsignedShort(valueField.Int())
+		case "UUID":
+			encoder = types.UUID(valueField.Interface().([16]byte))
 		case "VarInt":
 			encoder = types.VarInt(valueField.Int())
 		default:
@@ -0,0 +1,24 @@
+package protocol
+
+// Protocol versions with the configuration packets of 1.20.5, which has the
+// transfer packet
+const (
+	TransferMinVersion = 766 // 1.20.5
+	TransferMaxVersion = 769 // 1.21.4
+)
+
+const (
+	// Clientbound
+	ConfigurationDisconnectPacketID = byte(0x02)
+	ConfigurationKeepAlivePacketID  = byte(0x04)
+	ConfigurationTransferPacketID   = byte(0x0b)
+)
+
+type ConfigurationDisconnectPacket struct {
+	Reason []byte `protocol:"NBT"` // chat component
+}
+
+type TransferPacket struct {
+	Host string `protocol:"String"`
+	Port int    `protocol:"VarInt"`
+}
@@ -5,6 +5,7 @@ const HandshakePacketID = byte(0)
 const (
 	NextStateStatusRequest = 1
 	NextStateLoginRequest  = 2
+	NextStateTransfer      = 3 // 1.20.5, login after a transfer packet
 )
 
 type HandshakePacket struct {
@@ -1,8 +1,37 @@
 package protocol
 
-const LoginStartPacketID = byte(0)
+const (
+	// Serverbound
+	LoginStartPacketID        = byte(0)
+	LoginAcknowledgedPacketID = byte(3)
+
+	// Clientbound
+	LoginSuccessPacketID = byte(2)
+)
+
+// Protocol versions sending the player UUID in the login start packet
+const (
+	LoginStartOptionalUUIDVersion = 761 // 1.19.3, UUID after a boolean
+	LoginStartUUIDVersion         = 764 // 1.20.2
+)
+
+// Protocol versions changing the login success packet
+const (
+	LoginAcknowledgedVersion    = 764 // 1.20.2, configuration state
+	LoginSuccessStrictVersion   = 766 // 1.20.5, properties and strict flag
+	LoginSuccessNoStrictVersion = 768 // 1.21.2, properties only
+)
 
 type LoginStartPacket struct {
 	Data     []byte `protocol:"_data"`
 	Username string `protocol:"String"`
+
+	// Decoded depending on protocol version
+	PlayerUUID    [16]byte `protocol:"-"`
+	HasPlayerUUID bool     `protocol:"-"`
+}
+
+type LoginSuccessPacket struct {
+	PlayerUUID [16]byte `protocol:"UUID"`
+	Username   string   `protocol:"String"`
 }
@@ -0,0 +1,74 @@
+package protocol
+
+// Protocol versions with the play packets of 1.17, whose join game packet
+// has a dimension codec
+const (
+	Play117MinVersion = 755 // 1.17
+	Play117MaxVersion = 756 // 1.17.1
+)
+
+const (
+	// Serverbound
+	Play117TeleportConfirmPacketID = byte(0x00)
+	Play117KeepAlivePacketID       = byte(0x0f)
+
+	// Clientbound
+	Play117DisconnectPacketID      = byte(0x1a)
+	Play117KeepAliveClientPacketID = byte(0x21)
+	Play117JoinGamePacketID        = byte(0x26)
+	Play117PlayerPositionPacketID  = byte(0x38)
+	Play117ActionBarPacketID       = byte(0x41)
+	Play117TitleTextPacketID       = byte(0x59)
+	Play117TitleTimesPacketID      = byte(0x5a)
+)
+
+// Game modes
+const (
+	GameModeSpectator = 3
+	GameModeNone      = -1
+)
+
+type JoinGamePacket struct {
+	EntityID            int      `protocol:"Int"`
+	IsHardcore          bool     `protocol:"Boolean"`
+	GameMode            int      `protocol:"Byte"`
+	PreviousGameMode    int      `protocol:"Byte"`
+	WorldNames          []string `protocol:"StringArray"`
+	DimensionCodec      []byte   `protocol:"NBT"`
+	Dimension           []byte   `protocol:"NBT"`
+	WorldName           string   `protocol:"String"`
+	HashedSeed          int64    `protocol:"Long"`
+	MaxPlayers          int      `protocol:"VarInt"`
+	ViewDistance        int      `protocol:"VarInt"`
+	ReducedDebugInfo    bool     `protocol:"Boolean"`
+	EnableRespawnScreen bool     `protocol:"Boolean"`
+	IsDebug             bool     `protocol:"Boolean"`
+	IsFlat              bool     `protocol:"Boolean"`
+}
+
+type PlayerPositionPacket struct {
+	X               float64 `protocol:"Double"`
+	Y               float64 `protocol:"Double"`
+	Z               float64 `protocol:"Double"`
+	Yaw             float32 `protocol:"Float"`
+	Pitch           float32 `protocol:"Float"`
+	Flags           int     `protocol:"Byte"`
+	TeleportID      int     `protocol:"VarInt"`
+	DismountVehicle bool    `protocol:"Boolean"`
+}
+
+type KeepAlivePacket struct {
+	ID int64 `protocol:"Long"`
+}
+
+// A ChatPacket is a packet with only a JSON chat component, such as the
+// action bar, title text and disconnect packets.
+type ChatPacket struct {
+	Message string `protocol:"String"`
+}
+
+type TitleTimesPacket struct {
+	FadeIn  int `protocol:"Int"`
+	Stay    int `protocol:"Int"`
+	FadeOut int `protocol:"Int"`
+}
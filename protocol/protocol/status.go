@@ -1,5 +1,9 @@
 package protocol
 
+import (
+	"encoding/json"
+)
+
 const (
 	// Serverbound
 	StatusRequestPacketID = byte(0)
@@ -18,10 +22,10 @@ type StatusResponsePacket struct {
 }
 
 type ServerStatus struct {
-	Version     Version     `json:"version"`
-	Players     Players     `json:"players"`
-	Description Description `json:"description"`
-	Favicon     string      `json:"favicon,omitempty"`
+	Version     Version         `json:"version"`
+	Players     Players         `json:"players"`
+	Description json.RawMessage `json:"description"` // chat component
+	Favicon     string          `json:"favicon,omitempty"`
 }
 
 type Version struct {
@@ -40,10 +44,6 @@ type PlayerSample struct {
 	ID   string `json:"id"`
 }
 
-type Description struct {
-	Text string `json:"text"`
-}
-
 type ServerText struct {
 	Text string `json:"text"`
 }
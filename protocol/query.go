@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"golem/protocol/protocol"
+)
+
+// QueryStatus queries the status of a server, returning its status JSON.
+// The handshake uses protocolVersion, and the whole query must complete
+// within timeout.
+func QueryStatus(
+	addr string,
+	protocolVersion int,
+	timeout time.Duration,
+) (string, error) {
+
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return "", err
+	}
+	c := NewClientConn(conn, nil)
+	defer c.Close()
+
+	err = c.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", err
+	}
+
+	// Handshake into the status state and request status
+	err = c.WriteHandshakePacket(protocol.HandshakePacket{
+		ProtocolVersion: protocolVersion,
+		ServerAddress:   host,
+		ServerPort:      port,
+		NextState:       protocol.NextStateStatusRequest,
+	})
+	if err != nil {
+		return "", err
+	}
+	err = c.WriteStatusRequestPacket()
+	if err != nil {
+		return "", err
+	}
+
+	p, err := c.ReadStatusResponsePacket()
+	if err != nil {
+		return "", err
+	}
+
+	return p.StatusResponse, nil
+
+}
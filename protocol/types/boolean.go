@@ -0,0 +1,26 @@
+package types
+
+import (
+	"io"
+)
+
+type Boolean bool
+
+func (b Boolean) Encode() []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (b *Boolean) Decode(r io.ByteReader) error {
+
+	v, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	*b = v != 0
+	return nil
+
+}
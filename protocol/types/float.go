@@ -0,0 +1,22 @@
+package types
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+type Float float32
+
+func (f Float) Encode() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+	return b
+}
+
+type Double float64
+
+func (d Double) Encode() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(float64(d)))
+	return b
+}
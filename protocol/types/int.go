@@ -0,0 +1,42 @@
+package types
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type Int int32
+
+func (i Int) Encode() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(i))
+	return b
+}
+
+func (i *Int) Decode(r io.ByteReader) error {
+
+	b, err := readN(r, 4)
+	if err != nil {
+		return err
+	}
+
+	*i = Int(binary.BigEndian.Uint32(b))
+	return nil
+
+}
+
+// readN reads n bytes from a reader.
+func readN(r io.ByteReader, n int) ([]byte, error) {
+
+	b := make([]byte, n)
+	for i := range b {
+		v, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		b[i] = v
+	}
+
+	return b, nil
+
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type Long int64
+
+func (l Long) Encode() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(l))
+	return b
+}
+
+func (l *Long) Decode(r io.ByteReader) error {
+
+	b, err := readN(r, 8)
+	if err != nil {
+		return err
+	}
+
+	*l = Long(binary.BigEndian.Uint64(b))
+	return nil
+
+}
@@ -0,0 +1,19 @@
+package types
+
+// Raw is data that is already encoded, such as NBT.
+type Raw []byte
+
+func (r Raw) Encode() []byte {
+	return r
+}
+
+// StringArray is a VarInt length followed by strings.
+type StringArray []string
+
+func (a StringArray) Encode() []byte {
+	b := VarInt(len(a)).Encode()
+	for _, s := range a {
+		b = append(b, String(s).Encode()...)
+	}
+	return b
+}
@@ -6,6 +6,10 @@ import (
 
 type UnsignedShort uint16
 
+func (u UnsignedShort) Encode() []byte {
+	return []byte{byte(u >> 8), byte(u)}
+}
+
 func (u *UnsignedShort) Decode(r io.ByteReader) error {
 
 	byte1, err := r.ReadByte()
@@ -18,7 +22,7 @@ func (u *UnsignedShort) Decode(r io.ByteReader) error {
 		return err
 	}
 
-	*u = UnsignedShort(int16(byte1)<<8 | int16(byte2))
+	*u = UnsignedShort(uint16(byte1)<<8 | uint16(byte2))
 	return nil
 
 }
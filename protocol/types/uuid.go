@@ -0,0 +1,43 @@
+package types
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+)
+
+type UUID [16]byte
+
+// OfflineUUID returns the UUID of a player on a server in offline mode, a
+// version 3 UUID of "OfflinePlayer:" and the name.
+func OfflineUUID(name string) UUID {
+	u := UUID(md5.Sum([]byte("OfflinePlayer:" + name)))
+	u[6] = u[6]&0x0f | 0x30
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+func (u UUID) Encode() []byte {
+	return u[:]
+}
+
+func (u *UUID) Decode(r io.ByteReader) error {
+
+	for i := range u {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		u[i] = b
+	}
+
+	return nil
+
+}
+
+// String returns the UUID in its hyphenated form.
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" +
+		s[20:]
+}
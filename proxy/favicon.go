@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// faviconSize is the width and height of a favicon.
+const faviconSize = 64
+
+// A favicon is a server icon loaded from a PNG file, reloaded when the file
+// changes.
+type favicon struct {
+	logger *log.Logger
+	path   string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	dataURI string
+}
+
+// newFavicon returns a new favicon for a PNG file.
+func newFavicon(logger *log.Logger, path string) *favicon {
+	f := favicon{}
+	f.logger = logger
+	f.path = path
+	return &f
+}
+
+// get returns the favicon as a data URI, or an empty string if the file does
+// not exist or is not a 64x64 PNG.
+func (f *favicon) get() string {
+
+	if f == nil {
+		return ""
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Reload only when the file changed
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			f.logger.Printf("error reading favicon: %s\n", err)
+		}
+		f.modTime = time.Time{}
+		f.dataURI = ""
+		return ""
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.dataURI
+	}
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	f.dataURI, err = loadFavicon(f.path)
+	if err != nil {
+		f.logger.Printf("error loading favicon: %s\n", err)
+	}
+	return f.dataURI
+
+}
+
+// loadFavicon reads and checks a favicon, returning it as a data URI.
+func loadFavicon(path string) (string, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	if config.Width != faviconSize || config.Height != faviconSize {
+		return "", fmt.Errorf(
+			"%s: expected %dx%d image but got %dx%d",
+			path,
+			faviconSize,
+			faviconSize,
+			config.Width,
+			config.Height,
+		)
+	}
+
+	return "data:image/png;base64," +
+		base64.StdEncoding.EncodeToString(data), nil
+
+}
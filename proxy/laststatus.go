@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	protocolDefinitions "golem/protocol/protocol"
+)
+
+// A lastStatus is the last status a server returned, shown while the server
+// is not running.
+type lastStatus struct {
+	Version     protocolDefinitions.Version `json:"version"`
+	PlayersMax  int                         `json:"playersMax"`
+	Description json.RawMessage             `json:"description"`
+	Favicon     string                      `json:"favicon,omitempty"`
+}
+
+// parseLastStatus parses a last status from a server status JSON.
+func parseLastStatus(status string) (*lastStatus, error) {
+
+	var serverStatus protocolDefinitions.ServerStatus
+	err := json.Unmarshal([]byte(status), &serverStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	s := lastStatus{}
+	s.Version = serverStatus.Version
+	s.PlayersMax = serverStatus.Players.Max
+	s.Description = serverStatus.Description
+	s.Favicon = serverStatus.Favicon
+	if len(s.Description) == 0 {
+		s.Description = json.RawMessage(`""`)
+	}
+	return &s, nil
+
+}
+
+// loadLastStatus reads a last status file, returning nil if it does not
+// exist.
+func loadLastStatus(path string) (*lastStatus, error) {
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s lastStatus
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+
+}
+
+// save writes the last status file, replacing it atomically.
+func (s *lastStatus) save(path string) error {
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+
+}
+
+// equal returns if two last statuses are the same.
+func (s *lastStatus) equal(other *lastStatus) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	a, _ := json.Marshal(s)
+	b, _ := json.Marshal(other)
+	return bytes.Equal(a, b)
+}
+
+// serverStatus returns the status to show, with a suffix chat component
+// appended to the description and the current players.
+func (s *lastStatus) serverStatus(
+	suffix json.RawMessage,
+	playersOnline int,
+	playerSample []protocolDefinitions.PlayerSample,
+) (protocolDefinitions.ServerStatus, error) {
+
+	// Append the suffix as a sibling component to keep the formatting of the
+	// description
+	description := s.Description
+	if len(suffix) > 0 {
+		var err error
+		description, err = json.Marshal(struct {
+			Text  string            `json:"text"`
+			Extra []json.RawMessage `json:"extra"`
+		}{
+			Text:  "",
+			Extra: []json.RawMessage{s.Description, json.RawMessage(`" "`), suffix},
+		})
+		if err != nil {
+			return protocolDefinitions.ServerStatus{}, err
+		}
+	}
+
+	return protocolDefinitions.ServerStatus{
+		Version: s.Version,
+		Players: protocolDefinitions.Players{
+			Max:    s.PlayersMax,
+			Online: playersOnline,
+			Sample: playerSample,
+		},
+		Description: description,
+		Favicon:     s.Favicon,
+	}, nil
+
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"time"
+
+	"golem/protocol"
+	protocolDefinitions "golem/protocol/protocol"
+	serverPkg "golem/server"
+)
+
+// limboInterval is the interval to update players in limbo.
+const limboInterval = time.Second
+
+// limboKeepAliveInterval is the interval to keep players in limbo from
+// timing out.
+const limboKeepAliveInterval = 10 * time.Second
+
+// limboCloseTimeout is the time for a player to leave after a transfer or
+// disconnect, so the packet is not lost by closing first.
+const limboCloseTimeout = 5 * time.Second
+
+// limbo finishes the login of a player and keeps them waiting while the
+// server starts. Clients of 1.17 join an empty world with the startup
+// progress in the action bar and are asked to reconnect when the server
+// runs. Clients of 1.20.5 and later wait in the configuration state and are
+// transferred to the server when it runs.
+func (r *Route) limbo(
+	conn *protocol.ClientConn,
+	options *RouteOptions,
+	handshakePacket protocolDefinitions.HandshakePacket,
+	loginPacket protocolDefinitions.LoginStartPacket,
+) {
+
+	protocolVersion := handshakePacket.ProtocolVersion
+	play := protocol.LimboPlay(protocolVersion)
+	p := newPlayer(loginPacket, conn.RemoteAddr().String())
+
+	// The stop timer starts when the player leaves limbo in any way, and is
+	// reset when they join the server
+	r.addWaiting()
+	defer r.removeWaiting()
+
+	// Finish login and join the limbo world
+	err := func() error {
+
+		err := conn.WriteLoginSuccessPacket(
+			protocolDefinitions.LoginSuccessPacket{
+				PlayerUUID: p.uuid,
+				Username:   p.name,
+			},
+			protocolVersion,
+		)
+		if err != nil || !play {
+			return err
+		}
+
+		err = conn.WriteLimboJoin()
+		if err != nil {
+			return err
+		}
+
+		return conn.WriteLimboTitle(
+			r.render(options, serverPkg.Starting, options.Messages.LimboTitle),
+		)
+
+	}()
+	if err != nil {
+		r.logger.Printf("error joining limbo: %s\n", err)
+		return
+	}
+
+	// Notice the player leaving, ignoring their packets
+	left := make(chan struct{})
+	go func() {
+		conn.DiscardPackets()
+		close(left)
+	}()
+
+	// leave waits for the player to leave after a transfer or disconnect
+	leave := func(err error) {
+		if err != nil {
+			r.logger.Printf("error leaving limbo: %s\n", err)
+			return
+		}
+		select {
+		case <-left:
+		case <-time.After(limboCloseTimeout):
+		}
+	}
+
+	// disconnect disconnects the player with a message template
+	disconnect := func(state serverPkg.ServerState, template string) {
+		leave(conn.WriteLimboDisconnect(
+			r.render(options, state, template),
+			protocolVersion,
+		))
+	}
+
+	// Subscribe before checking the state to not miss changes
+	events, cancel := r.server.Subscribe()
+	defer cancel()
+	deadline := time.Now().Add(options.LimboTimeout)
+	ticker := time.NewTicker(limboInterval)
+	defer ticker.Stop()
+
+	started := false
+	var keepAliveTime time.Time
+	for {
+
+		if !r.startWaiting(&started) {
+			disconnect(serverPkg.Stopped, options.Messages.StartFailed)
+			return
+		}
+
+		state := r.server.State()
+		switch {
+		case state == serverPkg.Running && play:
+			r.logger.Printf("player ready: %s\n", p.name)
+			disconnect(state, options.Messages.Ready)
+			return
+		case state == serverPkg.Running:
+			r.logger.Printf("transferring player: %s\n", p.name)
+			leave(conn.WriteTransferPacket(
+				normalizeHostname(handshakePacket.ServerAddress),
+				handshakePacket.ServerPort,
+			))
+			return
+		case time.Now().After(deadline):
+			disconnect(state, options.Messages.Starting)
+			return
+		}
+
+		// Keep the player and show the progress
+		err := func() error {
+			if time.Since(keepAliveTime) >= limboKeepAliveInterval {
+				keepAliveTime = time.Now()
+				err := conn.WriteLimboKeepAlive(
+					keepAliveTime.UnixNano(),
+					protocolVersion,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			if !play {
+				return nil
+			}
+			return conn.WriteLimboActionBar(
+				r.render(options, state, options.Messages.Starting),
+			)
+		}()
+		if err != nil {
+			r.logger.Printf("error updating limbo: %s\n", err)
+			return
+		}
+
+		select {
+		case <-left:
+			r.logger.Printf("player left limbo: %s\n", p.name)
+			return
+		case <-events:
+		case <-ticker.C:
+		}
+
+	}
+
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+func TestLimboLeaveStartsStopTimer(t *testing.T) {
+
+	for _, protocolVersion := range []int{756, 767} {
+
+		server := servertest.NewServer(serverPkg.Starting)
+		r := newTestRoute(server, func(options *RouteOptions) {
+			options.Limbo = true
+		})
+		r.Idle()
+
+		// The player in limbo resets the stop timer
+		client, done := startLogin(t, r, protocolVersion)
+		_, err := client.Read(make([]byte, 1))
+		if err != nil {
+			t.Fatalf("%d: reading login success: %s", protocolVersion, err)
+		}
+		if stopTimerRunning(r) {
+			t.Errorf("%d: stop timer running in limbo", protocolVersion)
+		}
+
+		// The stop timer starts when the player quits
+		client.Close()
+		waitDone(t, done)
+		if !stopTimerRunning(r) {
+			t.Errorf("%d: stop timer not running after leaving limbo",
+				protocolVersion)
+		}
+
+	}
+
+}
+
+func TestLimboTimeoutStartsStopTimer(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Starting)
+	r := newTestRoute(server, func(options *RouteOptions) {
+		options.Limbo = true
+		options.LimboTimeout = 10 * time.Millisecond
+	})
+
+	// The player is disconnected, then leaves
+	client, done := startLogin(t, r, 756)
+	go io.Copy(io.Discard, client)
+	time.AfterFunc(100*time.Millisecond, func() { client.Close() })
+	waitDone(t, done)
+
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after limbo timed out")
+	}
+
+}
+
+func TestLimboKeepsServerForOthers(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Starting)
+	r := newTestRoute(server, func(options *RouteOptions) {
+		options.Limbo = true
+		options.HoldLogin = true
+		options.HoldTimeout = 10 * time.Millisecond
+	})
+
+	// A player waits in limbo
+	limbo, limboDone := startLogin(t, r, 756)
+	_, err := limbo.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatalf("reading login success: %s", err)
+	}
+	go io.Copy(io.Discard, limbo)
+
+	// Another player held without limbo support gives up
+	held, heldDone := startLogin(t, r, 340)
+	go io.Copy(io.Discard, held)
+	waitDone(t, heldDone)
+	if stopTimerRunning(r) {
+		t.Error("stop timer running while a player is in limbo")
+	}
+
+	limbo.Close()
+	waitDone(t, limboDone)
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after leaving limbo")
+	}
+
+}
@@ -1,18 +1,70 @@
 package proxy
 
 const (
-	statusStarting = "[starting]"
+	statusStarting = "[starting {progress}]"
 	statusStopping = "[stopping]"
 	statusRunning  = "[running]"
 	statusStopped  = "[stopped]"
+	statusCrashed  = "[crashed: {crash}]"
+	statusPaused   = "[paused]"
 )
 
 const (
 	serverStopped         = "server is stopped"
-	serverStarting        = "server is starting..."
+	serverStarting        = "server is starting... {progress}, eta {eta}"
 	serverStopping        = "server is stopping..."
-	serverStartInitiated  = "server start initiated"
+	serverStartInitiated  = "server start initiated, eta {eta}"
 	serverStartFailed     = "server start failed"
+	serverCrashed         = "server crashed: {crash}"
 	serverConnectFailed   = "server connect failed"
 	serverHandshakeFailed = "server handshake failed"
+	serverUnknown         = "unknown server address"
+	serverLimboTitle      = "§6{server} is starting"
+	serverReady           = "server is ready, reconnect to join"
 )
+
+// Messages are the status descriptions and disconnect messages of a route.
+type Messages struct {
+	StatusStarting string
+	StatusStopping string
+	StatusRunning  string
+	StatusStopped  string
+	StatusCrashed  string
+	StatusPaused   string
+	Stopped        string
+	Starting       string
+	Stopping       string
+	StartInitiated string
+	StartFailed    string
+	Crashed        string
+	ConnectFailed  string
+	LimboTitle     string
+	Ready          string
+}
+
+// WithDefaults returns the messages with empty messages set to the defaults.
+func (m Messages) WithDefaults() Messages {
+	setDefault(&m.StatusStarting, statusStarting)
+	setDefault(&m.StatusStopping, statusStopping)
+	setDefault(&m.StatusRunning, statusRunning)
+	setDefault(&m.StatusStopped, statusStopped)
+	setDefault(&m.StatusCrashed, statusCrashed)
+	setDefault(&m.StatusPaused, statusPaused)
+	setDefault(&m.Stopped, serverStopped)
+	setDefault(&m.Starting, serverStarting)
+	setDefault(&m.Stopping, serverStopping)
+	setDefault(&m.StartInitiated, serverStartInitiated)
+	setDefault(&m.StartFailed, serverStartFailed)
+	setDefault(&m.Crashed, serverCrashed)
+	setDefault(&m.ConnectFailed, serverConnectFailed)
+	setDefault(&m.LimboTitle, serverLimboTitle)
+	setDefault(&m.Ready, serverReady)
+	return m
+}
+
+// setDefault sets an empty message to a default.
+func setDefault(message *string, defaultMessage string) {
+	if *message == "" {
+		*message = defaultMessage
+	}
+}
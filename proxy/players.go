@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"sort"
+	"time"
+
+	protocolDefinitions "golem/protocol/protocol"
+	"golem/protocol/types"
+)
+
+// anonymousPlayer is the name shown in the player sample for hidden names.
+const anonymousPlayer = "Anonymous Player"
+
+// A player is a player connected through a route.
+type player struct {
+	name  string
+	uuid  types.UUID
+	addr  string
+	since time.Time
+}
+
+// newPlayer returns a new player connected now, with the UUID from a login
+// start packet, or the offline mode UUID if it has none.
+func newPlayer(
+	loginPacket protocolDefinitions.LoginStartPacket,
+	addr string,
+) *player {
+	p := player{}
+	p.name = loginPacket.Username
+	if loginPacket.HasPlayerUUID {
+		p.uuid = loginPacket.PlayerUUID
+	} else {
+		p.uuid = types.OfflineUUID(p.name)
+	}
+	p.addr = addr
+	p.since = time.Now()
+	return &p
+}
+
+// A PlayerInfo is a connected player.
+type PlayerInfo struct {
+	Name  string
+	UUID  string
+	Addr  string    // remote address of the client
+	Since time.Time // when the player connected
+}
+
+// Players returns the connected players sorted by name.
+func (r *Route) Players() []PlayerInfo {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	players := []PlayerInfo{}
+	for p := range r.players {
+		players = append(players, PlayerInfo{
+			Name:  p.name,
+			UUID:  p.uuid.String(),
+			Addr:  p.addr,
+			Since: p.since,
+		})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+	return players
+
+}
+
+// playerSample returns the player sample of the status for a set of players,
+// sorted by name and capped at max entries, with names hidden if hideNames.
+func playerSample(
+	players map[*player]bool,
+	max int,
+	hideNames bool,
+) []protocolDefinitions.PlayerSample {
+
+	names := make([]*player, 0, len(players))
+	for p := range players {
+		names = append(names, p)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].name < names[j].name
+	})
+
+	sample := []protocolDefinitions.PlayerSample{}
+	for _, p := range names {
+		if len(sample) >= max {
+			break
+		}
+		if hideNames {
+			sample = append(sample, protocolDefinitions.PlayerSample{
+				Name: anonymousPlayer,
+				ID:   types.UUID{}.String(),
+			})
+			continue
+		}
+		sample = append(sample, protocolDefinitions.PlayerSample{
+			Name: p.name,
+			ID:   p.uuid.String(),
+		})
+	}
+
+	return sample
+
+}
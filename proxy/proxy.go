@@ -1,63 +1,75 @@
 package proxy
 
 import (
-	"io"
 	"log"
 	"net"
-	"time"
+	"strings"
+	"sync"
 
 	"golem/protocol"
 	protocolDefinitions "golem/protocol/protocol"
-	serverPkg "golem/server"
 )
 
-// A Proxy proxies a Minecraft server.
+// A Proxy proxies Minecraft servers, routing connections by the hostname in
+// the handshake.
 type Proxy struct {
 	logger         *log.Logger
 	protocolLogger *log.Logger
-	server         serverPkg.Server
 	proxyAddr      string
-	serverAddr     string
 
-	stopDuration *time.Duration // nil disables autostart/stop
-	stopTimer    *time.Timer
-
-	players map[string]bool // set of usernames
-
-	versionName     string
-	versionProtocol int
-	playersMax      int
+	mu           sync.RWMutex
+	routes       map[string]*Route // by hostname
+	defaultRoute *Route            // nil rejects unknown hostnames
 }
 
 // NewProxy returns a new Proxy.
 //
-// Autostart/stop is disabled when stopDuration is nil.
+// Connections with unknown hostnames use defaultRoute, or are rejected when
+// defaultRoute is nil.
 // Optional packet logging is disabled when protocolLogger is nil.
 func NewProxy(
 	logger *log.Logger,
 	proxyAddr string,
-	serverAddr string,
-	stopDuration *time.Duration,
-	server serverPkg.Server,
+	defaultRoute *Route,
 	protocolLogger *log.Logger,
-	versionName string,
-	versionProtocol int,
-	playersMax int,
 ) *Proxy {
 	p := Proxy{}
 	p.logger = logger
 	p.proxyAddr = proxyAddr
-	p.serverAddr = serverAddr
-	p.stopDuration = stopDuration
-	p.server = server
-	p.players = make(map[string]bool)
+	p.routes = make(map[string]*Route)
+	p.defaultRoute = defaultRoute
 	p.protocolLogger = protocolLogger
-	p.versionName = versionName
-	p.versionProtocol = versionProtocol
-	p.playersMax = playersMax
 	return &p
 }
 
+// Addr returns the proxy listen address.
+func (p *Proxy) Addr() string {
+	return p.proxyAddr
+}
+
+// AddRoute routes connections with a hostname to a route.
+func (p *Proxy) AddRoute(hostname string, route *Route) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes[normalizeHostname(hostname)] = route
+}
+
+// SetRoutes replaces all routes by hostname and the default route.
+// Existing connections keep their route.
+func (p *Proxy) SetRoutes(routes map[string]*Route, defaultRoute *Route) {
+
+	normalized := make(map[string]*Route)
+	for hostname, route := range routes {
+		normalized[normalizeHostname(hostname)] = route
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes = normalized
+	p.defaultRoute = defaultRoute
+
+}
+
 // Run starts a proxy listen loop.
 func (p *Proxy) Run() error {
 
@@ -77,13 +89,13 @@ func (p *Proxy) Run() error {
 		go p.handleConnection(protocol.NewClientConn(conn, p.protocolLogger))
 	}
 
-	return nil
-
 }
 
 // handleConnection handles an incoming connection.
 func (p *Proxy) handleConnection(conn *protocol.ClientConn) {
 
+	defer conn.Close()
+
 	// Read handshake packet
 	handshakePacket, err := conn.ReadHandshakePacket()
 	if err != nil {
@@ -91,150 +103,52 @@ func (p *Proxy) handleConnection(conn *protocol.ClientConn) {
 		return
 	}
 
-	// Handle depending on handshake next state
-	switch handshakePacket.NextState {
-	case protocolDefinitions.NextStateStatusRequest:
-
-		// Read status request packet
-		_, err = conn.ReadStatusRequestPacket()
-		if err != nil {
-			p.logger.Printf("error reading status request packet: %s\n", err)
-			return
-		}
-
-		// Write status message depending on server state
-		var statusMessage string
-		switch p.server.State() {
-		case serverPkg.Starting:
-			statusMessage = statusStarting
-		case serverPkg.Stopped:
-			statusMessage = statusStopped
-		case serverPkg.Running:
-			statusMessage = statusRunning
-		case serverPkg.Stopping:
-			statusMessage = statusStopping
-		}
-		err = conn.WriteMessageStatus(
-			statusMessage,
-			p.versionName,
-			p.versionProtocol,
-			len(p.players),
-			p.playersMax,
+	// Find route by hostname
+	route := p.route(handshakePacket.ServerAddress)
+	if route == nil {
+		p.logger.Printf(
+			"no route for hostname: %s\n",
+			normalizeHostname(handshakePacket.ServerAddress),
 		)
-		if err != nil {
-			p.logger.Printf("error sending message: %s\n", err)
-			return
-		}
-
-		// Read and respond to ping packet
-		err = conn.ReadAndRespondPing()
-		if err != nil {
-			p.logger.Printf("error handling ping: %s\n", err)
-			return
-		}
-
-	case protocolDefinitions.NextStateLoginRequest:
-
-		// Write text message depending on server state
-		// Continue only when state is Running
-		switch p.server.State() {
-		case serverPkg.Starting:
-			err = conn.WriteMessageText(serverStarting)
+		if handshakePacket.NextState != protocolDefinitions.NextStateStatusRequest {
+			err = conn.WriteMessageText(serverUnknown)
 			if err != nil {
 				p.logger.Printf("error sending message: %s\n", err)
 			}
-			return
-		case serverPkg.Stopping:
-			err = conn.WriteMessageText(serverStopping)
-			if err != nil {
-				p.logger.Printf("error sending message: %s\n", err)
-			}
-			return
-		case serverPkg.Stopped:
-
-			// Start server if autostart/stop enabled
-			if p.stopDuration != nil {
-				p.logger.Println("starting server")
-				err = p.server.Start()
-				if err != nil {
-					err = conn.WriteMessageText(serverStartFailed)
-				} else {
-					err = conn.WriteMessageText(serverStartInitiated)
-				}
-			} else {
-				err = conn.WriteMessageText(serverStopped)
-			}
-			if err != nil {
-				p.logger.Printf("error sending message: %s\n", err)
-				return
-			}
-
-			return
-		}
-
-		// Read login start packet
-		loginPacket, err := conn.ReadLoginStartPacket()
-		if err != nil {
-			p.logger.Printf("error reading login start packet: %s\n", err)
-			return
-		}
-
-		// Connect to server
-		serverConn, err := net.Dial("tcp", p.serverAddr)
-		if err != nil {
-			p.logger.Printf("error connecting to server: %s\n", err)
-			conn.WriteMessageText(serverConnectFailed)
-			return
-		}
-		defer serverConn.Close()
-
-		// Catch up server connection
-		_, err = serverConn.Write(handshakePacket.Data)
-		if err != nil {
-			p.logger.Printf("error writing to server: %s\n", err)
-			return
-		}
-		_, err = serverConn.Write(loginPacket.Data)
-		if err != nil {
-			p.logger.Printf("error writing to server: %s\n", err)
-			return
 		}
+		return
+	}
 
-		// Player connected
-		username := loginPacket.Username
-		p.logger.Printf("player connected: %s\n", username)
-		p.players[username] = true
-		if p.stopDuration != nil && p.stopTimer != nil {
-			p.logger.Println("reseting stop timer")
-			p.stopTimer.Stop()
-			p.stopTimer = nil
-		}
+	// Handle depending on handshake next state
+	switch handshakePacket.NextState {
+	case protocolDefinitions.NextStateStatusRequest:
+		route.handleStatus(conn, handshakePacket)
+	case protocolDefinitions.NextStateLoginRequest,
+		protocolDefinitions.NextStateTransfer:
+		route.handleLogin(conn, handshakePacket)
+	}
 
-		// Pipe connections in both directions
-		// Ensure pipes close together
-		stop := false
-		go p.pipe(serverConn, conn, &stop)
-		p.pipe(conn, serverConn, &stop)
-
-		// Player disconnected
-		p.logger.Printf("player disconnected: %s\n", username)
-		delete(p.players, username)
-		if p.stopDuration != nil && len(p.players) == 0 {
-			p.logger.Println("starting stop timer")
-			p.stopTimer = time.AfterFunc(*p.stopDuration, func() {
-				p.server.Stop()
-				p.stopTimer = nil
-			})
-		}
+}
 
+// route returns the route for a handshake server address, or the default
+// route if there is none.
+func (p *Proxy) route(serverAddress string) *Route {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	route, ok := p.routes[normalizeHostname(serverAddress)]
+	if !ok {
+		return p.defaultRoute
 	}
-
+	return route
 }
 
-// pipe wraps the pipe implementation to catch errors.
-func (p *Proxy) pipe(src io.ReadCloser, dst io.WriteCloser, stop *bool) {
-	err := pipe(src, dst, stop)
-	if err != nil {
-		p.logger.Printf("error forwarding connection: %s\n", err)
+// normalizeHostname normalizes a handshake server address for lookup.
+// Strips data appended by modded clients (e.g. "\x00FML\x00") and a trailing
+// dot, and lowercases.
+func normalizeHostname(serverAddress string) string {
+	if i := strings.IndexByte(serverAddress, 0); i >= 0 {
+		serverAddress = serverAddress[:i]
 	}
+	serverAddress = strings.TrimSuffix(serverAddress, ".")
+	return strings.ToLower(serverAddress)
 }
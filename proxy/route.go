@@ -0,0 +1,725 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golem/protocol"
+	protocolDefinitions "golem/protocol/protocol"
+	serverPkg "golem/server"
+)
+
+// A Route is a Minecraft server behind the proxy, selected by the hostname
+// clients connect with. Each route has its own server manager, idle timer,
+// player set and status.
+type Route struct {
+	logger *log.Logger
+	server serverPkg.Server
+
+	mu      sync.Mutex
+	options *RouteOptions // replaced on update
+
+	stopTimer  *time.Timer
+	stopTime   time.Time // when the stop timer fires
+	pauseTimer *time.Timer
+	players    map[*player]bool // set of players
+	waiting    int              // logins held or in limbo
+
+	statusMu   sync.Mutex // held while querying
+	status     string     // cached server status
+	statusTime time.Time
+	last       *lastStatus
+	lastLoaded bool
+}
+
+// RouteOptions are the options of a route, which can change on update.
+// Connections keep the options they started with.
+type RouteOptions struct {
+	Name         string // server name for messages
+	ServerAddr   string
+	StopDuration *time.Duration // nil disables autostart/stop
+
+	// PauseDuration pauses servers that can pause after being idle for this
+	// long, before they stop, where zero disables pausing
+	PauseDuration time.Duration
+
+	// Messages are the status descriptions and disconnect message templates,
+	// where empty messages use the defaults
+	Messages Messages
+
+	// MOTD is the status description template, where empty uses "{state}"
+	MOTD            string
+	VersionName     string
+	VersionProtocol int
+	PlayersMax      int
+
+	// ForwardStatus relays the server status while running, caching it for
+	// StatusCacheDuration
+	ForwardStatus       bool
+	StatusCacheDuration time.Duration
+
+	// LastStatus shows the last forwarded status while the server is not
+	// running, with SleepingSuffix or StartingSuffix appended to the
+	// description, and saves it to LastStatusFile when not empty
+	LastStatus     bool
+	LastStatusFile string
+	SleepingSuffix string
+	StartingSuffix string
+
+	// FaviconFile is a 64x64 PNG shown in made up statuses and last statuses
+	// without a favicon, reloaded when changed
+	FaviconFile string
+
+	// HoldLogin keeps logins open while the server starts if autostart/stop
+	// is enabled, for at most HoldTimeout, instead of disconnecting
+	HoldLogin   bool
+	HoldTimeout time.Duration
+
+	// Limbo finishes logins of supported clients while the server starts if
+	// autostart/stop is enabled, keeping them in an empty world for at most
+	// LimboTimeout, then transfers them to the server or asks them to
+	// reconnect
+	Limbo        bool
+	LimboTimeout time.Duration
+
+	// PlayerSampleMax caps the players in the status player sample, whose
+	// names are hidden if HidePlayerNames
+	PlayerSampleMax int
+	HidePlayerNames bool
+
+	favicon *favicon
+}
+
+// statusQueryTimeout is the timeout of a server status query.
+const statusQueryTimeout = 2 * time.Second
+
+// NewRoute returns a new Route.
+func NewRoute(
+	logger *log.Logger,
+	server serverPkg.Server,
+	options RouteOptions,
+) *Route {
+	r := Route{}
+	r.logger = logger
+	r.server = server
+	r.players = make(map[*player]bool)
+	options.Messages = options.Messages.WithDefaults()
+	if options.MOTD == "" {
+		options.MOTD = "{state}"
+	}
+	if options.FaviconFile != "" {
+		options.favicon = newFavicon(logger, options.FaviconFile)
+	}
+	r.options = &options
+	return &r
+}
+
+// Server returns the server manager of the route.
+func (r *Route) Server() serverPkg.Server {
+	return r.server
+}
+
+// Update replaces the options of the route with the options of another
+// route, keeping the server manager, players and stop timer.
+// Existing connections keep their options.
+func (r *Route) Update(other *Route) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.options = other.currentOptions()
+}
+
+// PlayerCount returns the number of connected players.
+func (r *Route) PlayerCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.players)
+}
+
+// playerSample returns the status player sample.
+func (r *Route) playerSample(
+	options *RouteOptions,
+) []protocolDefinitions.PlayerSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return playerSample(
+		r.players,
+		options.PlayerSampleMax,
+		options.HidePlayerNames,
+	)
+}
+
+// currentOptions returns the current options.
+func (r *Route) currentOptions() *RouteOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.options
+}
+
+// values returns the values of the template placeholders for a server
+// state.
+func (r *Route) values(
+	options *RouteOptions,
+	state serverPkg.ServerState,
+) templateValues {
+
+	var uptime time.Duration
+	if uptimer, ok := r.server.(serverPkg.Uptimer); ok {
+		uptime = uptimer.Uptime()
+	}
+
+	values := templateValues{
+		"server":   options.Name,
+		"players":  strconv.Itoa(r.PlayerCount()),
+		"max":      strconv.Itoa(options.PlayersMax),
+		"version":  options.VersionName,
+		"eta":      "unknown",
+		"progress": "0%",
+		"uptime":   formatDuration(uptime),
+	}
+
+	// Startup progress is known only while starting
+	if reporter, ok := r.server.(serverPkg.StartupReporter); ok {
+		progress, ok := reporter.StartupProgress()
+		if ok && progress.Remaining >= 0 {
+			values["eta"] = formatDuration(progress.Remaining)
+		}
+		if ok && progress.Percent >= 0 {
+			values["progress"] = strconv.Itoa(progress.Percent) + "%"
+		}
+	}
+
+	// The last crash is known until the server runs again
+	crash, crashed := r.lastCrash()
+	values["crash"] = crash.Reason
+
+	// The state message can use the other placeholders
+	var stateMessage string
+	switch state {
+	case serverPkg.Starting:
+		stateMessage = options.Messages.StatusStarting
+	case serverPkg.Stopped:
+		stateMessage = options.Messages.StatusStopped
+		if crashed {
+			stateMessage = options.Messages.StatusCrashed
+		}
+	case serverPkg.Running:
+		stateMessage = options.Messages.StatusRunning
+	case serverPkg.Stopping:
+		stateMessage = options.Messages.StatusStopping
+	case serverPkg.Paused:
+		stateMessage = options.Messages.StatusPaused
+	}
+	values["state"] = expand(stateMessage, values, false)
+
+	return values
+
+}
+
+// lastCrash returns the last crash of the server if it reports crashes.
+func (r *Route) lastCrash() (serverPkg.Crash, bool) {
+	reporter, ok := r.server.(serverPkg.CrashReporter)
+	if !ok {
+		return serverPkg.Crash{}, false
+	}
+	return reporter.LastCrash()
+}
+
+// render renders a message template for a server state.
+func (r *Route) render(
+	options *RouteOptions,
+	state serverPkg.ServerState,
+	template string,
+) json.RawMessage {
+	return render(template, r.values(options, state))
+}
+
+// writeMessage renders and sends a message template for a server state,
+// logging errors.
+func (r *Route) writeMessage(
+	conn *protocol.ClientConn,
+	options *RouteOptions,
+	state serverPkg.ServerState,
+	template string,
+) {
+	err := conn.WriteMessage(r.render(options, state, template))
+	if err != nil {
+		r.logger.Printf("error sending message: %s\n", err)
+	}
+}
+
+// handleStatus handles a connection in the status state.
+func (r *Route) handleStatus(
+	conn *protocol.ClientConn,
+	handshakePacket protocolDefinitions.HandshakePacket,
+) {
+
+	options := r.currentOptions()
+
+	// Read status request packet
+	_, err := conn.ReadStatusRequestPacket()
+	if err != nil {
+		r.logger.Printf("error reading status request packet: %s\n", err)
+		return
+	}
+
+	// Write status
+	err = r.writeStatus(conn, options, handshakePacket.ProtocolVersion)
+	if err != nil {
+		r.logger.Printf("error sending message: %s\n", err)
+		return
+	}
+
+	// Resume a paused server, a login may follow
+	r.wake()
+
+	// Read and respond to ping packet
+	err = conn.ReadAndRespondPing()
+	if err != nil {
+		r.logger.Printf("error handling ping: %s\n", err)
+		return
+	}
+
+}
+
+// handleLogin handles a connection in the login state.
+func (r *Route) handleLogin(
+	conn *protocol.ClientConn,
+	handshakePacket protocolDefinitions.HandshakePacket,
+) {
+
+	var err error
+	options := r.currentOptions()
+	state := r.wake()
+
+	// Do not start a server that keeps crashing
+	crash, crashed := r.lastCrash()
+	if state == serverPkg.Stopped && crashed && crash.GaveUp {
+		r.writeMessage(conn, options, state, options.Messages.Crashed)
+		return
+	}
+
+	// Wait in limbo or hold the login while the server starts if enabled,
+	// otherwise write text message depending on server state
+	// Continue only when state is Running
+	waiting := options.StopDuration != nil && state != serverPkg.Running
+	limbo := waiting &&
+		options.Limbo &&
+		(protocol.LimboPlay(handshakePacket.ProtocolVersion) ||
+			protocol.LimboTransfer(handshakePacket.ProtocolVersion))
+	holding := waiting && !limbo && options.HoldLogin
+	switch {
+	case limbo, holding, state == serverPkg.Running:
+	case state == serverPkg.Starting:
+		r.writeMessage(conn, options, state, options.Messages.Starting)
+		return
+	case state == serverPkg.Stopping:
+		r.writeMessage(conn, options, state, options.Messages.Stopping)
+		return
+	case state == serverPkg.Paused:
+		// Resuming failed
+		r.writeMessage(conn, options, state, options.Messages.StartFailed)
+		return
+	case state == serverPkg.Stopped:
+
+		// Start server if autostart/stop enabled
+		if options.StopDuration == nil {
+			r.writeMessage(conn, options, state, options.Messages.Stopped)
+			return
+		}
+		// Tell why it stopped if it crashed
+		r.logger.Println("starting server")
+		message := options.Messages.StartInitiated
+		if crashed {
+			message = options.Messages.Crashed
+		}
+		err = r.server.Start()
+		if err != nil && !errors.Is(err, serverPkg.ErrNotStopped) {
+			r.writeMessage(conn, options, state, options.Messages.StartFailed)
+		} else {
+			r.writeMessage(conn, options, r.server.State(), message)
+		}
+
+		// Stop the server if the player does not come back
+		r.Idle()
+		return
+
+	}
+
+	// Read login start packet
+	loginPacket, err := conn.ReadLoginStartPacket(
+		handshakePacket.ProtocolVersion,
+	)
+	if err != nil {
+		r.logger.Printf("error reading login start packet: %s\n", err)
+		return
+	}
+
+	// Wait in limbo until the server runs
+	if limbo {
+		r.logger.Printf("player in limbo: %s\n", loginPacket.Username)
+		r.limbo(conn, options, handshakePacket, loginPacket)
+		return
+	}
+
+	// Wait for the server to run, then continue as if it was running
+	// The stop timer starts when the login ends unless the player plays
+	if holding {
+		r.addWaiting()
+		defer r.removeWaiting()
+		r.logger.Printf("holding login: %s\n", loginPacket.Username)
+		message, ok := r.holdLogin(options)
+		if !ok {
+			r.writeMessage(conn, options, r.server.State(), message)
+			return
+		}
+	}
+
+	// Connect to server
+	serverConn, err := net.Dial("tcp", options.ServerAddr)
+	if err != nil {
+		r.logger.Printf("error connecting to server: %s\n", err)
+		r.writeMessage(
+			conn,
+			options,
+			serverPkg.Running,
+			options.Messages.ConnectFailed,
+		)
+		return
+	}
+	defer serverConn.Close()
+
+	// Catch up server connection, as a login if the player was transferred
+	// so the server need not accept transfers
+	if handshakePacket.NextState == protocolDefinitions.NextStateTransfer {
+		handshakePacket.NextState = protocolDefinitions.NextStateLoginRequest
+		err = protocol.NewClientConn(serverConn, nil).WriteHandshakePacket(
+			handshakePacket,
+		)
+	} else {
+		_, err = serverConn.Write(handshakePacket.Data)
+	}
+	if err != nil {
+		r.logger.Printf("error writing to server: %s\n", err)
+		return
+	}
+	_, err = serverConn.Write(loginPacket.Data)
+	if err != nil {
+		r.logger.Printf("error writing to server: %s\n", err)
+		return
+	}
+
+	// Player connected
+	p := newPlayer(loginPacket, conn.RemoteAddr().String())
+	r.logger.Printf("player connected: %s\n", p.name)
+	r.addPlayer(p)
+
+	// Pipe connections in both directions
+	// Pipes close both connections, so they exit together
+	go r.pipe(serverConn, conn)
+	r.pipe(conn, serverConn)
+
+	// Player disconnected
+	r.logger.Printf("player disconnected: %s\n", p.name)
+	r.removePlayer(p)
+
+}
+
+// addPlayer adds a connected player and resets the stop and pause timers.
+func (r *Route) addPlayer(p *player) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.players[p] = true
+	r.resetStopTimer()
+
+}
+
+// addWaiting adds a login held or in limbo, which resets the stop and pause
+// timers like a player.
+func (r *Route) addWaiting() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waiting++
+	r.resetStopTimer()
+
+}
+
+// removeWaiting removes a login that is not held or in limbo anymore,
+// starting the stop and pause timers like Idle.
+func (r *Route) removeWaiting() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waiting--
+	r.idle()
+
+}
+
+// resetStopTimer stops the stop and pause timers. Must hold mu.
+func (r *Route) resetStopTimer() {
+
+	if r.stopTimer != nil {
+		r.logger.Println("reseting stop timer")
+		r.stopTimer.Stop()
+		r.stopTimer = nil
+	}
+	if r.pauseTimer != nil {
+		r.pauseTimer.Stop()
+		r.pauseTimer = nil
+	}
+
+}
+
+// removePlayer removes a disconnected player, starting the stop and pause
+// timers with the current options when it was the last player and no login
+// is waiting.
+func (r *Route) removePlayer(p *player) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.players, p)
+	if len(r.players) == 0 && r.waiting == 0 {
+		r.startStopTimer()
+	}
+
+}
+
+// Idle starts the stop and pause timers if the server is not stopped and
+// there are no players or waiting logins, such as for a server adopted after
+// a restart.
+func (r *Route) Idle() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.idle()
+}
+
+// idle implements Idle. Must hold mu.
+func (r *Route) idle() {
+	if r.server.State() != serverPkg.Stopped &&
+		len(r.players) == 0 &&
+		r.waiting == 0 {
+		r.startStopTimer()
+	}
+}
+
+// startStopTimer starts the stop and pause timers with the current options
+// if autostart/stop is enabled. Must hold mu.
+func (r *Route) startStopTimer() {
+
+	if r.options.StopDuration == nil {
+		return
+	}
+
+	r.logger.Println("starting stop timer")
+	r.setStopTimer(*r.options.StopDuration)
+	r.startPauseTimer()
+
+}
+
+// setStopTimer starts the stop timer to stop the server after a duration,
+// replacing a running one. Must hold mu.
+func (r *Route) setStopTimer(d time.Duration) {
+
+	if r.stopTimer != nil {
+		r.stopTimer.Stop()
+	}
+
+	// The timer stops the server only if it was not reset meanwhile
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		r.mu.Lock()
+		current := r.stopTimer == timer
+		if current {
+			r.stopTimer = nil
+		}
+		r.mu.Unlock()
+		if !current {
+			return
+		}
+		if stopper, ok := r.server.(serverPkg.IdleStopper); ok {
+			stopper.StopIdle()
+		} else {
+			r.server.Stop()
+		}
+	})
+	r.stopTimer = timer
+	r.stopTime = time.Now().Add(d)
+
+}
+
+// StopTime returns when the stop timer stops the server, or false if it is
+// not running.
+func (r *Route) StopTime() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopTime, r.stopTimer != nil
+}
+
+// CancelStopTimer stops the stop and pause timers until the last player
+// leaves again. Returns false if the stop timer was not running.
+func (r *Route) CancelStopTimer() bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pauseTimer != nil {
+		r.pauseTimer.Stop()
+		r.pauseTimer = nil
+	}
+	if r.stopTimer == nil {
+		return false
+	}
+	r.logger.Println("canceling stop timer")
+	r.stopTimer.Stop()
+	r.stopTimer = nil
+	return true
+
+}
+
+// ExtendStopTimer delays the stop timer by a duration, returning the new
+// stop time, or false if it is not running.
+func (r *Route) ExtendStopTimer(d time.Duration) (time.Time, bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopTimer == nil {
+		return time.Time{}, false
+	}
+	r.logger.Printf("extending stop timer by %s\n", d)
+	r.setStopTimer(time.Until(r.stopTime.Add(d)))
+	return r.stopTime, true
+
+}
+
+// startPauseTimer starts the pause timer with the current options if the
+// server can pause, replacing a running one. Must hold mu.
+func (r *Route) startPauseTimer() {
+
+	pauser, ok := r.server.(serverPkg.Pauser)
+	if !ok || r.options.PauseDuration == 0 {
+		return
+	}
+	if r.pauseTimer != nil {
+		r.pauseTimer.Stop()
+	}
+
+	// The timer pauses the server only if it was not reset meanwhile
+	var timer *time.Timer
+	timer = time.AfterFunc(r.options.PauseDuration, func() {
+		r.mu.Lock()
+		current := r.pauseTimer == timer
+		if current {
+			r.pauseTimer = nil
+		}
+		r.mu.Unlock()
+		if !current {
+			return
+		}
+		r.logger.Println("pausing server")
+		err := pauser.Pause()
+		if err != nil {
+			r.logger.Printf("error pausing server: %s\n", err)
+		}
+	})
+	r.pauseTimer = timer
+
+}
+
+// wake resumes the server if it is paused, and pauses it again later if no
+// player joins. The stop timer keeps running. Returns the server state.
+func (r *Route) wake() serverPkg.ServerState {
+
+	state := r.server.State()
+	pauser, ok := r.server.(serverPkg.Pauser)
+	if state != serverPkg.Paused || !ok {
+		return state
+	}
+
+	r.logger.Println("resuming server")
+	err := pauser.Resume()
+	if err != nil {
+		r.logger.Printf("error resuming server: %s\n", err)
+	}
+
+	r.mu.Lock()
+	if len(r.players) == 0 {
+		r.startPauseTimer()
+	}
+	r.mu.Unlock()
+
+	return r.server.State()
+
+}
+
+// holdLogin starts the server if it is stopped and waits until it is running
+// for at most the hold timeout. Returns the message template to disconnect
+// with if the server is not running.
+func (r *Route) holdLogin(options *RouteOptions) (string, bool) {
+
+	// Subscribe before checking the state to not miss changes
+	events, cancel := r.server.Subscribe()
+	defer cancel()
+	timeout := time.NewTimer(options.HoldTimeout)
+	defer timeout.Stop()
+
+	started := false
+	for {
+
+		if !r.startWaiting(&started) {
+			return options.Messages.StartFailed, false
+		}
+		if r.server.State() == serverPkg.Running {
+			return "", true
+		}
+
+		select {
+		case <-events:
+		case <-timeout.C:
+			return options.Messages.Starting, false
+		}
+
+	}
+
+}
+
+// startWaiting starts the server for a waiting login if it is stopped.
+// Returns false if the start failed, including when the server stopped
+// again after started was set.
+func (r *Route) startWaiting(started *bool) bool {
+
+	if r.server.State() != serverPkg.Stopped {
+		return true
+	}
+
+	// Stopped again after starting means the start failed
+	if *started {
+		return false
+	}
+	// Another login starting the server is not a failure
+	r.logger.Println("starting server")
+	*started = true
+	err := r.server.Start()
+	return err == nil || errors.Is(err, serverPkg.ErrNotStopped)
+
+}
+
+// pipe wraps the pipe implementation to catch errors. Connections closed by
+// either side are not errors.
+func (r *Route) pipe(src io.ReadCloser, dst io.WriteCloser) {
+	err := pipe(src, dst)
+	if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+		r.logger.Printf("error forwarding connection: %s\n", err)
+	}
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"golem/protocol"
+	protocolDefinitions "golem/protocol/protocol"
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// newTestRoute returns a new Route to a fake server with autostart/stop,
+// changing its options.
+func newTestRoute(
+	server serverPkg.Server,
+	change func(options *RouteOptions),
+) *Route {
+	stopDuration := time.Hour
+	options := RouteOptions{
+		Name:            "test",
+		ServerAddr:      "127.0.0.1:1", // refuses connections
+		StopDuration:    &stopDuration,
+		VersionProtocol: 756,
+		HoldTimeout:     time.Hour,
+		LimboTimeout:    time.Hour,
+	}
+	change(&options)
+	return NewRoute(log.New(io.Discard, "", 0), server, options)
+}
+
+// startLogin handles a login with a protocol version on a route, returning
+// the client end and a channel closed when the route is done with it.
+func startLogin(
+	t *testing.T,
+	r *Route,
+	protocolVersion int,
+) (net.Conn, chan struct{}) {
+
+	client, proxy := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer proxy.Close()
+		r.handleLogin(
+			protocol.NewClientConn(proxy, nil),
+			protocolDefinitions.HandshakePacket{
+				ProtocolVersion: protocolVersion,
+				ServerAddress:   "localhost",
+				ServerPort:      25565,
+				NextState:       protocolDefinitions.NextStateLoginRequest,
+			},
+		)
+	}()
+
+	// Login start: length, packet id and name, written unless the route
+	// disconnects first
+	name := "Steve"
+	data := append([]byte{byte(2 + len(name)), 0, byte(len(name))}, name...)
+	go client.Write(data)
+	return client, done
+
+}
+
+// waitDone waits for a route to be done with a login.
+func waitDone(t *testing.T, done chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(servertest.WaitTimeout):
+		t.Fatal("login not done")
+	}
+}
+
+// stopTimerRunning returns if the stop timer of a route runs.
+func stopTimerRunning(r *Route) bool {
+	_, ok := r.StopTime()
+	return ok
+}
+
+func TestStartedLoginStartsStopTimer(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Stopped)
+	r := newTestRoute(server, func(options *RouteOptions) {})
+
+	// The player is disconnected after the start
+	client, done := startLogin(t, r, 756)
+	go io.Copy(io.Discard, client)
+	waitDone(t, done)
+
+	if server.State() != serverPkg.Running {
+		t.Errorf("server is %s after login", server.State())
+	}
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after start")
+	}
+
+}
+
+func TestHoldTimeoutStartsStopTimer(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Starting)
+	r := newTestRoute(server, func(options *RouteOptions) {
+		options.HoldLogin = true
+		options.HoldTimeout = 10 * time.Millisecond
+	})
+
+	client, done := startLogin(t, r, 756)
+	go io.Copy(io.Discard, client)
+	waitDone(t, done)
+
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after hold timed out")
+	}
+
+}
+
+func TestHoldConnectFailedStartsStopTimer(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Stopped)
+	r := newTestRoute(server, func(options *RouteOptions) {
+		options.HoldLogin = true
+	})
+
+	// The server runs at once, but refuses the connection
+	client, done := startLogin(t, r, 756)
+	go io.Copy(io.Discard, client)
+	waitDone(t, done)
+
+	if server.State() != serverPkg.Running {
+		t.Errorf("server is %s after login", server.State())
+	}
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after connect failed")
+	}
+
+}
+
+func TestHoldResetsStopTimer(t *testing.T) {
+
+	server := servertest.NewServer(serverPkg.Starting)
+	r := newTestRoute(server, func(options *RouteOptions) {
+		options.HoldLogin = true
+	})
+	r.Idle()
+
+	// Held logins keep the server from stopping
+	client, done := startLogin(t, r, 756)
+	servertest.Eventually(
+		t,
+		func() bool { return !stopTimerRunning(r) },
+		"stop timer reset by held login",
+	)
+
+	r.Idle()
+	if stopTimerRunning(r) {
+		t.Error("stop timer running while holding login")
+	}
+
+	// The stop timer starts again when the login ends
+	server.Follow(serverPkg.Running)
+	go io.Copy(io.Discard, client)
+	waitDone(t, done)
+	if !stopTimerRunning(r) {
+		t.Error("stop timer not running after held login")
+	}
+
+}
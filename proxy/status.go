@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"golem/protocol"
+	serverPkg "golem/server"
+)
+
+// writeStatus writes the server status while running if forwarding is
+// enabled, otherwise or on failure a status message depending on server
+// state.
+func (r *Route) writeStatus(
+	conn *protocol.ClientConn,
+	options *RouteOptions,
+	protocolVersion int,
+) error {
+
+	state := r.server.State()
+
+	// Relay server status
+	if options.ForwardStatus && state == serverPkg.Running {
+		status, err := r.serverStatus(options, protocolVersion)
+		if err == nil {
+			return conn.WriteStatus(status)
+		}
+		r.logger.Printf("error querying server status: %s\n", err)
+	}
+
+	// Write last status while not running
+	if options.LastStatus && state != serverPkg.Running {
+		last := r.lastStatus(options)
+		if last != nil {
+			suffix := options.SleepingSuffix
+			if state == serverPkg.Starting {
+				suffix = options.StartingSuffix
+			}
+			var suffixMessage json.RawMessage
+			if suffix != "" {
+				suffixMessage = r.render(options, state, suffix)
+			}
+			serverStatus, err := last.serverStatus(
+				suffixMessage,
+				r.PlayerCount(),
+				r.playerSample(options),
+			)
+			if err != nil {
+				return err
+			}
+			if serverStatus.Favicon == "" {
+				serverStatus.Favicon = options.favicon.get()
+			}
+			return conn.WriteServerStatus(serverStatus)
+		}
+	}
+
+	// Write status message depending on server state
+	return conn.WriteMessageStatus(
+		r.render(options, state, options.MOTD),
+		options.VersionName,
+		options.VersionProtocol,
+		r.PlayerCount(),
+		options.PlayersMax,
+		r.playerSample(options),
+		options.favicon.get(),
+	)
+
+}
+
+// serverStatus returns the server status JSON, queried at most once per
+// status cache duration.
+func (r *Route) serverStatus(
+	options *RouteOptions,
+	protocolVersion int,
+) (string, error) {
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	if r.status != "" &&
+		time.Since(r.statusTime) < options.StatusCacheDuration {
+		return r.status, nil
+	}
+
+	status, err := protocol.QueryStatus(
+		options.ServerAddr,
+		protocolVersion,
+		statusQueryTimeout,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	r.status = status
+	r.statusTime = time.Now()
+	if options.LastStatus {
+		r.rememberStatus(options, status)
+	}
+	return status, nil
+
+}
+
+// lastStatus returns the last status, loading it from the last status file
+// the first time. Returns nil if there is none.
+func (r *Route) lastStatus(options *RouteOptions) *lastStatus {
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	if !r.lastLoaded && options.LastStatusFile != "" {
+		last, err := loadLastStatus(options.LastStatusFile)
+		if err != nil {
+			r.logger.Printf("error loading last status: %s\n", err)
+		}
+		r.last = last
+	}
+	r.lastLoaded = true
+
+	return r.last
+
+}
+
+// rememberStatus sets the last status from a server status JSON, saving it
+// to the last status file when it changed. Must hold statusMu.
+func (r *Route) rememberStatus(options *RouteOptions, status string) {
+
+	last, err := parseLastStatus(status)
+	if err != nil {
+		r.logger.Printf("error parsing server status: %s\n", err)
+		return
+	}
+	if last.equal(r.last) {
+		return
+	}
+	r.last = last
+	r.lastLoaded = true
+
+	if options.LastStatusFile != "" {
+		err = last.save(options.LastStatusFile)
+		if err != nil {
+			r.logger.Printf("error saving last status: %s\n", err)
+		}
+	}
+
+}
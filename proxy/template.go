@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golem/protocol/chat"
+)
+
+// templateValues are the values of placeholders in message templates by
+// name, such as "players" for {players}.
+type templateValues map[string]string
+
+// render renders a message template into a chat component. A template is
+// either a JSON chat component or text with legacy formatting codes, with
+// placeholders substituted and escaped in JSON templates.
+// Invalid templates are rendered as text.
+func render(template string, values templateValues) json.RawMessage {
+
+	isJSON := chat.IsJSON(template)
+	message, err := chat.Parse(expand(template, values, isJSON))
+	if err != nil {
+		message, _ = json.Marshal(chat.Component{Text: template})
+	}
+	return message
+
+}
+
+// expand substitutes the placeholders in a template, escaping the values for
+// JSON strings when escapeJSON is set.
+func expand(template string, values templateValues, escapeJSON bool) string {
+
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	var oldnew []string
+	for name, value := range values {
+		if escapeJSON {
+			bytes, _ := json.Marshal(value)
+			value = string(bytes[1 : len(bytes)-1])
+		}
+		oldnew = append(oldnew, "{"+name+"}", value)
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(template)
+
+}
+
+// formatDuration formats a duration for messages, rounded to seconds.
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
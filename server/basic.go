@@ -1,10 +1,21 @@
 package server
 
-type BasicServer struct{}
+import (
+	"context"
+	"time"
+)
+
+type BasicServer struct {
+	created time.Time
+	states  *StateMachine // always Running
+}
 
 // NewBasicServer returns a new basic server.
 func NewBasicServer() *BasicServer {
-	return &BasicServer{}
+	return &BasicServer{
+		created: time.Now(),
+		states:  NewStateMachine(Running),
+	}
 }
 
 // Start implements Server.
@@ -18,7 +29,10 @@ func (s *BasicServer) Stop() error {
 }
 
 // Execute implements Server.
-func (s *BasicServer) Execute(command string) (string, error) {
+func (s *BasicServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
 	return "", nil
 }
 
@@ -26,3 +40,15 @@ func (s *BasicServer) Execute(command string) (string, error) {
 func (s *BasicServer) State() ServerState {
 	return Running
 }
+
+// Subscribe implements Server. There are no events since the state never
+// changes.
+func (s *BasicServer) Subscribe() (<-chan StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements Uptimer, assuming the server is running since the basic
+// server was made.
+func (s *BasicServer) Uptime() time.Duration {
+	return time.Since(s.created)
+}
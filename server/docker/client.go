@@ -0,0 +1,217 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// apiVersion is the Docker Engine API version used, supported by Docker 1.13
+// and later.
+const apiVersion = "v1.25"
+
+// A Client is a minimal client of the Docker Engine API over a unix socket.
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// A Container is the state of a container, as inspected.
+type Container struct {
+	State struct {
+		Status    string    // such as "created", "running" or "exited"
+		StartedAt time.Time // zero if never started
+		Health    *struct {
+			Status string // "starting", "healthy" or "unhealthy"
+		}
+	}
+}
+
+// NewClient returns a new Client for a unix socket path.
+func NewClient(socket string) *Client {
+	c := Client{}
+	c.socket = socket
+	c.http = &http.Client{
+		Transport: &http.Transport{
+			DialContext: c.dial,
+		},
+	}
+	return &c
+}
+
+// dial connects to the socket, whatever the address.
+func (c *Client) dial(
+	ctx context.Context,
+	network string,
+	addr string,
+) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", c.socket)
+}
+
+// Inspect returns the state of a container.
+func (c *Client) Inspect(ctx context.Context, id string) (Container, error) {
+
+	var container Container
+	resp, err := c.do(ctx, http.MethodGet, containerPath(id)+"/json", nil)
+	if err != nil {
+		return container, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&container)
+	return container, err
+
+}
+
+// Start starts a container, which may be running already.
+func (c *Client) Start(ctx context.Context, id string) error {
+	return c.post(ctx, containerPath(id)+"/start", nil)
+}
+
+// Stop stops a container with its stop signal, killing it after a timeout.
+// The container may be stopped already.
+func (c *Client) Stop(
+	ctx context.Context,
+	id string,
+	timeout time.Duration,
+) error {
+	query := url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}}
+	return c.post(ctx, containerPath(id)+"/stop", query)
+}
+
+// Pause freezes the processes of a container.
+func (c *Client) Pause(ctx context.Context, id string) error {
+	return c.post(ctx, containerPath(id)+"/pause", nil)
+}
+
+// Unpause continues the processes of a paused container.
+func (c *Client) Unpause(ctx context.Context, id string) error {
+	return c.post(ctx, containerPath(id)+"/unpause", nil)
+}
+
+// Write writes data to the stdin of a container, which must have been
+// created with an open stdin.
+func (c *Client) Write(ctx context.Context, id string, data []byte) error {
+
+	conn, err := c.dial(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	// Attach upgrades the connection to a raw stream
+	query := url.Values{"stream": {"1"}, "stdin": {"1"}}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.url(containerPath(id)+"/attach", query),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	err = req.Write(conn)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols &&
+		resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("attach to container: %s", resp.Status)
+	}
+
+	_, err = conn.Write(data)
+	return err
+
+}
+
+// post posts to an endpoint without a body. Not modified responses are not
+// errors.
+func (c *Client) post(
+	ctx context.Context,
+	path string,
+	query url.Values,
+) error {
+	resp, err := c.do(ctx, http.MethodPost, path, query)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request, returning an error for error responses, with the
+// message of the engine.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		method,
+		c.url(path, query),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// Errors are {"message": "..."}
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		body.Message = resp.Status
+	}
+	return nil, fmt.Errorf("docker: %s", body.Message)
+
+}
+
+// containerPath returns the path of a container by name or id.
+func containerPath(id string) string {
+	return "/containers/" + id
+}
+
+// url returns the URL of an endpoint of the API version.
+func (c *Client) url(path string, query url.Values) string {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     "docker",
+		Path:     "/" + apiVersion + path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,456 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golem/protocol"
+	serverPkg "golem/server"
+	"golem/server/rcon"
+)
+
+// requestTimeout is the timeout of Engine API requests that return at once.
+const requestTimeout = 10 * time.Second
+
+// A DockerServer implements server.Server for a server in a Docker container,
+// started and stopped through the Docker Engine API. The state is polled from
+// the container status and health, or a status ping if the container has no
+// healthcheck, and commands are executed over RCON or written to the attached
+// stdin of the container.
+type DockerServer struct {
+	states  *serverPkg.StateMachine
+	logger  *log.Logger
+	client  *Client
+	options Options
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close to end polling
+
+	mu        sync.Mutex // guards state changes and fields below
+	startedAt time.Time  // of the container
+	starting  bool       // a start request is in flight
+	started   time.Time  // when the last start request completed
+	lastError string     // of polling, logged once
+}
+
+// Options are the options of a DockerServer.
+type Options struct {
+	// Socket is the path of the Engine API socket, and Container the name or
+	// id of the container, inspected every Interval
+	Socket    string
+	Container string
+	Interval  time.Duration
+
+	// ServerAddr is pinged with ProtocolVersion to find the server running
+	// if the container has no healthcheck
+	ServerAddr      string
+	ProtocolVersion int
+
+	// Rcon executes commands if not nil, otherwise commands are written to
+	// stdin without output
+	Rcon *rcon.Conn
+
+	// Save saves the world over RCON before pausing, waiting for at most
+	// SaveTimeout
+	Save        bool
+	SaveTimeout time.Duration
+
+	// StopTimeout is given to the engine to stop the container before it is
+	// killed
+	StopTimeout time.Duration
+}
+
+// NewDockerServer returns a new DockerServer, polling its state.
+func NewDockerServer(logger *log.Logger, options Options) *DockerServer {
+	s := DockerServer{}
+	s.states = serverPkg.NewStateMachine(serverPkg.Stopped)
+	s.logger = logger
+	s.client = NewClient(options.Socket)
+	s.options = options
+	s.closed = make(chan struct{})
+	go s.poll()
+	return &s
+}
+
+// Start implements server.Server by starting the container. The server is
+// running once the container is healthy.
+func (s *DockerServer) Start() error {
+
+	// State changes hold mu
+	s.mu.Lock()
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err == nil {
+		s.starting = true
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err = s.client.Start(ctx, s.options.Container)
+	if err != nil {
+		s.logger.Printf("error starting container: %s\n", err)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.starting = false
+		if s.states.State() == serverPkg.Starting {
+			reason := fmt.Sprintf("start failed: %s", err)
+			s.states.Set(serverPkg.Stopped, reason)
+		}
+		return err
+	}
+
+	s.logger.Println("started container")
+	s.mu.Lock()
+	s.starting = false
+	s.started = time.Now()
+	s.mu.Unlock()
+	return nil
+
+}
+
+// Stop implements server.Server by stopping the container, which the engine
+// kills after the stop timeout. Stopping a stopping server waits for it to
+// stop.
+func (s *DockerServer) Stop() error {
+
+	err := func() error {
+
+		// State changes hold mu
+		s.mu.Lock()
+		state := s.states.State()
+		var err error
+		switch state {
+		case serverPkg.Stopped:
+			err = serverPkg.ErrStopped
+		case serverPkg.Starting, serverPkg.Running, serverPkg.Paused:
+			err = s.states.Transition(
+				state,
+				serverPkg.Stopping,
+				"stop requested",
+			)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		// Wait for another stop
+		if state == serverPkg.Stopping {
+			ctx, cancel := context.WithTimeout(
+				context.Background(),
+				s.options.StopTimeout+requestTimeout,
+			)
+			defer cancel()
+			_, err := s.states.Wait(ctx, serverPkg.Stopped)
+			return err
+		}
+
+		// Paused containers stop once unpaused
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			s.options.StopTimeout+requestTimeout,
+		)
+		defer cancel()
+		if state == serverPkg.Paused {
+			err = s.client.Unpause(ctx, s.options.Container)
+		}
+		if err == nil {
+			err = s.client.Stop(
+				ctx,
+				s.options.Container,
+				s.options.StopTimeout,
+			)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			reason := fmt.Sprintf("stop failed: %s", err)
+			s.states.Transition(
+				serverPkg.Stopping,
+				serverPkg.Running,
+				reason,
+			)
+			return err
+		}
+		s.logger.Println("stopped container")
+		if s.states.State() == serverPkg.Stopping {
+			s.states.Set(serverPkg.Stopped, "container stopped")
+		}
+		return nil
+
+	}()
+	if err != nil {
+		s.logger.Printf("error stopping server: %s\n", err)
+	}
+
+	return err
+
+}
+
+// Execute implements server.Server over RCON, or by writing the command to
+// the stdin of the container without output.
+func (s *DockerServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	// Check for error case
+	if s.states.State() != serverPkg.Running {
+		return "", fmt.Errorf("tried to execute on server that is not running")
+	}
+
+	if s.options.Rcon != nil {
+		return s.options.Rcon.Execute(ctx, command)
+	}
+
+	err := s.client.Write(ctx, s.options.Container, []byte(command+"\n"))
+	return "", err
+
+}
+
+// State implements server.Server.
+func (s *DockerServer) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *DockerServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements server.Uptimer, from when the container started.
+func (s *DockerServer) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states.State() != serverPkg.Running {
+		return 0
+	}
+	return time.Since(s.startedAt)
+}
+
+// Pause implements server.Pauser by saving the world over RCON if enabled,
+// and pausing the container.
+func (s *DockerServer) Pause() error {
+
+	err := func() error {
+
+		// Check for error case
+		if s.states.State() != serverPkg.Running {
+			return fmt.Errorf("tried to pause server that is not running")
+		}
+
+		if s.options.Save && s.options.Rcon != nil {
+			ctx, cancel := context.WithTimeout(
+				context.Background(),
+				s.options.SaveTimeout,
+			)
+			_, err := s.options.Rcon.Execute(ctx, serverPkg.SaveCommand)
+			cancel()
+			if err != nil {
+				s.logger.Printf("error saving world: %s\n", err)
+			}
+		}
+
+		// State changes hold mu
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Unless stopped meanwhile
+		if s.states.State() != serverPkg.Running {
+			return fmt.Errorf("tried to pause server that is not running")
+		}
+
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			requestTimeout,
+		)
+		defer cancel()
+		err := s.client.Pause(ctx, s.options.Container)
+		if err != nil {
+			return err
+		}
+		s.logger.Println("paused container")
+		_, err = s.states.Set(serverPkg.Paused, "paused")
+		return err
+
+	}()
+	if err != nil {
+		s.logger.Printf("error pausing server: %s\n", err)
+	}
+
+	return err
+
+}
+
+// Resume implements server.Pauser by unpausing the container. Resuming a
+// server that is not paused does nothing.
+func (s *DockerServer) Resume() error {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.states.State() != serverPkg.Paused {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err := s.client.Unpause(ctx, s.options.Container)
+	if err != nil {
+		s.logger.Printf("error resuming server: %s\n", err)
+		return err
+	}
+	s.logger.Println("resumed container")
+	_, err = s.states.Set(serverPkg.Running, "resumed")
+	return err
+
+}
+
+// Close implements server.Closer by ending the polling and closing the RCON
+// connection, if any.
+func (s *DockerServer) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	if s.options.Rcon != nil {
+		s.options.Rcon.Close()
+	}
+	return nil
+}
+
+// poll updates the state from the container every interval, until closed.
+func (s *DockerServer) poll() {
+
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.update()
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+	}
+
+}
+
+// update inspects the container and follows its state, which is kept if
+// the container cannot be inspected.
+func (s *DockerServer) update() {
+
+	inspected := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	container, err := s.client.Inspect(ctx, s.options.Container)
+	target, reason := s.target(container)
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Log errors once until they change
+	if err != nil {
+		if err.Error() != s.lastError {
+			s.logger.Printf("error inspecting container: %s\n", err)
+		}
+		s.lastError = err.Error()
+		return
+	}
+	s.lastError = ""
+	s.startedAt = container.State.StartedAt
+
+	// Not stopped by containers inspected before they were started, while
+	// containers started by other tooling can stop while starting
+	state := s.states.State()
+	if state == serverPkg.Starting && target == serverPkg.Stopped &&
+		(s.starting || inspected.Before(s.started)) {
+		return
+	}
+
+	// Step through allowed transitions
+	for state != target {
+		next := step(state, target)
+		if next == state {
+			return
+		}
+		s.states.Transition(state, next, reason)
+		state = next
+	}
+
+}
+
+// target returns the server state of a container and the reason for it.
+func (s *DockerServer) target(
+	container Container,
+) (serverPkg.ServerState, string) {
+
+	status := container.State.Status
+	reason := "container " + status
+	switch status {
+
+	case "running":
+		if health := container.State.Health; health != nil {
+			if health.Status == "healthy" {
+				return serverPkg.Running, "container healthy"
+			}
+			return serverPkg.Starting, "container " + health.Status
+		}
+
+		// Without healthcheck, running once the server answers
+		_, err := protocol.QueryStatus(
+			s.options.ServerAddr,
+			s.options.ProtocolVersion,
+			s.options.Interval,
+		)
+		if err != nil {
+			return serverPkg.Starting, reason
+		}
+		return serverPkg.Running, "server reachable"
+
+	case "restarting":
+		return serverPkg.Starting, reason
+	case "paused":
+		return serverPkg.Paused, reason
+
+	}
+	return serverPkg.Stopped, reason
+
+}
+
+// step returns the next state on the way from one state to another, or the
+// same state if it must not change. Stopping servers wait to be stopped, and
+// running servers are not found starting again.
+func step(
+	from serverPkg.ServerState,
+	to serverPkg.ServerState,
+) serverPkg.ServerState {
+
+	if to == serverPkg.Stopped {
+		return to
+	}
+	switch from {
+	case serverPkg.Stopped:
+		return serverPkg.Starting
+	case serverPkg.Starting:
+		return serverPkg.Running
+	case serverPkg.Running:
+		if to == serverPkg.Paused {
+			return to
+		}
+	case serverPkg.Paused:
+		return serverPkg.Running
+	}
+	return from
+
+}
@@ -0,0 +1,388 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// A fakeEngine is a fake Docker Engine API with one container.
+type fakeEngine struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	name      string
+	status    string // container status
+	health    string // health status, or empty without healthcheck
+	startedAt time.Time
+	stdin     strings.Builder // written through attach
+	requests  []string        // by method and path
+}
+
+// newFakeEngine returns a new fakeEngine on a unix socket, with a stopped
+// container that has a healthcheck.
+func newFakeEngine(t *testing.T, name string) *fakeEngine {
+
+	listener, err := net.Listen(
+		"unix",
+		filepath.Join(t.TempDir(), "docker.sock"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := fakeEngine{}
+	e.name = name
+	e.status = "exited"
+	e.Server = httptest.NewUnstartedServer(http.HandlerFunc(e.handle))
+	e.Listener = listener
+	e.Start()
+	t.Cleanup(e.Close)
+	return &e
+
+}
+
+// handle handles a request of the Engine API.
+func (e *fakeEngine) handle(w http.ResponseWriter, r *http.Request) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, r.Method+" "+r.URL.Path)
+
+	prefix := "/" + apiVersion + containerPath(e.name) + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "No such container",
+		})
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, prefix) {
+	case "json":
+		var container Container
+		container.State.Status = e.status
+		container.State.StartedAt = e.startedAt
+		if e.health != "" {
+			container.State.Health = &struct{ Status string }{e.health}
+		}
+		json.NewEncoder(w).Encode(container)
+	case "start":
+		e.status = "running"
+		e.health = "starting"
+		e.startedAt = time.Now()
+		w.WriteHeader(http.StatusNoContent)
+	case "stop":
+		e.status = "exited"
+		e.health = "unhealthy"
+		w.WriteHeader(http.StatusNoContent)
+	case "pause":
+		e.status = "paused"
+		w.WriteHeader(http.StatusNoContent)
+	case "unpause":
+		e.status = "running"
+		w.WriteHeader(http.StatusNoContent)
+	case "attach":
+		e.attach(w)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+}
+
+// attach upgrades the connection to a raw stream and records the stdin
+// written to it. Must hold mu, which is released while reading.
+func (e *fakeEngine) attach(w http.ResponseWriter) {
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 UPGRADED\r\n" +
+		"Content-Type: application/vnd.docker.raw-stream\r\n" +
+		"Connection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	rw.Flush()
+
+	e.mu.Unlock()
+	data, _ := io.ReadAll(rw)
+	e.mu.Lock()
+	e.stdin.Write(data)
+
+}
+
+// set sets the container and health status.
+func (e *fakeEngine) set(status string, health string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+	e.health = health
+}
+
+// newTestServer returns a new DockerServer of the container of a fake
+// engine, closed when the test ends.
+func newTestServer(t *testing.T, e *fakeEngine) *DockerServer {
+	s := NewDockerServer(
+		log.New(io.Discard, "", 0),
+		Options{
+			Socket:      e.Listener.Addr().String(),
+			Container:   e.name,
+			Interval:    10 * time.Millisecond,
+			StopTimeout: time.Second,
+		},
+	)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestLifecycle(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := newTestServer(t, e)
+	events, cancel := s.Subscribe()
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+
+	// Running once healthy
+	time.Sleep(50 * time.Millisecond)
+	if s.State() != serverPkg.Starting {
+		t.Errorf("unhealthy container is %s, want starting", s.State())
+	}
+	e.set("running", "healthy")
+	servertest.Wait(t, s, serverPkg.Running)
+	if s.Uptime() <= 0 {
+		t.Error("running server has no uptime")
+	}
+
+	err = s.Pause()
+	if err != nil {
+		t.Fatalf("pause: %s", err)
+	}
+	err = s.Resume()
+	if err != nil {
+		t.Fatalf("resume: %s", err)
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", s.State())
+	}
+	err = s.Stop()
+	if err == nil {
+		t.Error("stop of stopped server: got no error")
+	}
+
+	// Events come in order
+	cancel()
+	var got []string
+	for event := range events {
+		got = append(got, event.New.String())
+	}
+	want := "starting running paused running stopping stopped"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got states %v, want %s", got, want)
+	}
+
+}
+
+func TestFollowContainer(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := newTestServer(t, e)
+
+	// Containers started and stopped by other tooling are followed
+	e.set("running", "healthy")
+	servertest.Wait(t, s, serverPkg.Running)
+	e.set("paused", "healthy")
+	servertest.Wait(t, s, serverPkg.Paused)
+
+	// An unhealthy container after unpausing stays running
+	events, cancel := s.Subscribe()
+	e.set("running", "unhealthy")
+	servertest.Wait(t, s, serverPkg.Running)
+	time.Sleep(50 * time.Millisecond)
+	e.set("exited", "")
+	servertest.Wait(t, s, serverPkg.Stopped)
+	cancel()
+
+	var got []string
+	for event := range events {
+		got = append(got, event.New.String())
+	}
+	if strings.Join(got, " ") != "running stopped" {
+		t.Errorf("got states %v, want running stopped", got)
+	}
+
+}
+
+func TestFollowFailedStart(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := newTestServer(t, e)
+
+	// Containers started by other tooling can exit while starting
+	e.set("running", "starting")
+	servertest.Wait(t, s, serverPkg.Starting)
+	e.set("exited", "unhealthy")
+	servertest.Wait(t, s, serverPkg.Stopped)
+
+}
+
+func TestExecuteAttach(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := newTestServer(t, e)
+	e.set("running", "healthy")
+	servertest.Wait(t, s, serverPkg.Running)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := s.Execute(ctx, "say hello")
+	if err != nil || output != "" {
+		t.Fatalf("execute: got %q, %v", output, err)
+	}
+
+	// The attach connection closes after the write
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.Lock()
+		stdin := e.stdin.String()
+		e.mu.Unlock()
+		if stdin == "say hello\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got stdin %q, want %q", stdin, "say hello\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+}
+
+func TestMissingContainer(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := NewDockerServer(
+		log.New(io.Discard, "", 0),
+		Options{
+			Socket:    e.Listener.Addr().String(),
+			Container: "other",
+			Interval:  10 * time.Millisecond,
+		},
+	)
+	defer s.Close()
+
+	err := s.Start()
+	if err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("start: got %v, want no such container", err)
+	}
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after failed start is %s", s.State())
+	}
+
+}
+
+func TestCloseEndsPolling(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	s := newTestServer(t, e)
+	e.set("running", "healthy")
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// The state is no longer updated, once a poll in flight is done
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	time.Sleep(5 * s.options.Interval)
+	e.set("exited", "")
+	time.Sleep(10 * s.options.Interval)
+	if state := s.State(); state != serverPkg.Running {
+		t.Errorf("closed server is %s", state)
+	}
+
+}
+
+func TestClientRequests(t *testing.T) {
+
+	e := newFakeEngine(t, "mc")
+	c := NewClient(e.Listener.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Start(ctx, "mc")
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	container, err := c.Inspect(ctx, "mc")
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+	if container.State.Status != "running" ||
+		container.State.Health == nil ||
+		container.State.Health.Status != "starting" ||
+		container.State.StartedAt.IsZero() {
+		t.Errorf("inspect: got %+v", container.State)
+	}
+	err = c.Stop(ctx, "mc", 30*time.Second)
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	want := []string{
+		"POST /v1.25/containers/mc/start",
+		"GET /v1.25/containers/mc/json",
+		"POST /v1.25/containers/mc/stop",
+	}
+	if strings.Join(e.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got requests %v, want %v", e.requests, want)
+	}
+
+}
+
+func TestStep(t *testing.T) {
+
+	tests := []struct {
+		from serverPkg.ServerState
+		to   serverPkg.ServerState
+		want serverPkg.ServerState
+	}{
+		{serverPkg.Stopped, serverPkg.Running, serverPkg.Starting},
+		{serverPkg.Starting, serverPkg.Running, serverPkg.Running},
+		{serverPkg.Running, serverPkg.Paused, serverPkg.Paused},
+		{serverPkg.Running, serverPkg.Starting, serverPkg.Running},
+		{serverPkg.Paused, serverPkg.Starting, serverPkg.Running},
+		{serverPkg.Paused, serverPkg.Running, serverPkg.Running},
+		{serverPkg.Stopping, serverPkg.Running, serverPkg.Stopping},
+		{serverPkg.Running, serverPkg.Stopped, serverPkg.Stopped},
+	}
+
+	for _, test := range tests {
+		got := step(test.from, test.to)
+		if got != test.want {
+			t.Errorf("step from %s to %s: got %s, want %s", test.from,
+				test.to, got, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,225 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where pods find the token, CA certificate and
+// namespace of their service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// errNotFound is returned for objects that do not exist.
+var errNotFound = errors.New("not found")
+
+// A Client is a minimal client of the Kubernetes API, authenticated with a
+// service account token.
+type Client struct {
+	api       string // URL, empty if not in a cluster
+	tokenFile string
+	http      *http.Client
+	err       error // of loading the CA certificate, returned by requests
+}
+
+// A StatefulSet is the state of a StatefulSet.
+type StatefulSet struct {
+	Spec struct {
+		Replicas int `json:"replicas"`
+	} `json:"spec"`
+}
+
+// A Pod is the state of a pod.
+type Pod struct {
+	Metadata struct {
+		DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		Conditions []struct {
+			Type               string    `json:"type"`
+			Status             string    `json:"status"`
+			LastTransitionTime time.Time `json:"lastTransitionTime"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// NewClient returns a new Client for an API URL, or the API of the cluster if
+// empty. The token, which is rotated, is read from tokenFile for every
+// request if it exists, and the API certificate is checked with the CA
+// certificate in caFile if it exists.
+func NewClient(api string, tokenFile string, caFile string) *Client {
+
+	c := Client{}
+	c.api = strings.TrimSuffix(api, "/")
+	c.tokenFile = tokenFile
+
+	// In the cluster, the API is a service
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	if c.api == "" && host != "" {
+		port := os.Getenv("KUBERNETES_SERVICE_PORT")
+		c.api = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	data, err := os.ReadFile(caFile)
+	if err != nil && !os.IsNotExist(err) {
+		c.err = err
+	}
+	if err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			c.err = fmt.Errorf("%s: no certificates", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	c.http = &http.Client{Transport: transport}
+
+	return &c
+
+}
+
+// StatefulSet returns a StatefulSet.
+func (c *Client) StatefulSet(
+	ctx context.Context,
+	namespace string,
+	name string,
+) (StatefulSet, error) {
+	var s StatefulSet
+	err := c.do(ctx, http.MethodGet, statefulSetPath(namespace, name), nil, &s)
+	return s, err
+}
+
+// Scale sets the replicas of a StatefulSet.
+func (c *Client) Scale(
+	ctx context.Context,
+	namespace string,
+	name string,
+	replicas int,
+) error {
+	patch := map[string]interface{}{
+		"spec": map[string]int{"replicas": replicas},
+	}
+	path := statefulSetPath(namespace, name) + "/scale"
+	return c.do(ctx, http.MethodPatch, path, patch, nil)
+}
+
+// Pod returns a pod, or errNotFound.
+func (c *Client) Pod(
+	ctx context.Context,
+	namespace string,
+	name string,
+) (Pod, error) {
+	var p Pod
+	path := "/api/v1/namespaces/" + namespace + "/pods/" + name
+	err := c.do(ctx, http.MethodGet, path, nil, &p)
+	return p, err
+}
+
+// Ready returns if a pod is ready, and since when.
+func (p Pod) Ready() (bool, time.Time) {
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True", condition.LastTransitionTime
+		}
+	}
+	return false, time.Time{}
+}
+
+// do sends a request with an optional JSON merge patch, decoding the
+// response into v if not nil. Returns errNotFound for missing objects, and
+// the message of the API for other errors.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	patch interface{},
+	v interface{},
+) error {
+
+	if c.err != nil {
+		return c.err
+	}
+	if c.api == "" {
+		return fmt.Errorf("not in a cluster, KUBERNETES_SERVICE_HOST not set")
+	}
+
+	var body io.Reader
+	if patch != nil {
+		data, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.api+path, body)
+	if err != nil {
+		return err
+	}
+	if patch != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	// Read the token every time as it is rotated
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		value := "Bearer " + strings.TrimSpace(string(token))
+		req.Header.Set("Authorization", value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Errors are a Status with a message
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = resp.Status
+		}
+		return fmt.Errorf("kubernetes: %s", status.Message)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+
+}
+
+// statefulSetPath returns the path of a StatefulSet.
+func statefulSetPath(namespace string, name string) string {
+	return "/apis/apps/v1/namespaces/" + namespace + "/statefulsets/" + name
+}
+
+// inClusterNamespace returns the namespace of the service account, or
+// "default" outside a cluster.
+func inClusterNamespace() string {
+	data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return "default"
+	}
+	return strings.TrimSpace(string(data))
+}
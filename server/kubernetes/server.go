@@ -0,0 +1,367 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/rcon"
+)
+
+// requestTimeout is the timeout of API requests.
+const requestTimeout = 10 * time.Second
+
+// A KubernetesServer implements server.Server for a server in a StatefulSet,
+// started and stopped by scaling it between 0 and 1 replicas through the
+// Kubernetes API. The state is polled from the readiness of its pod, and
+// commands are executed over RCON.
+type KubernetesServer struct {
+	states  *serverPkg.StateMachine
+	logger  *log.Logger
+	client  *Client
+	options Options
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close to end polling
+
+	mu         sync.Mutex // guards state changes and fields below
+	readySince time.Time  // of the pod
+	scaling    bool       // a start is scaling up
+	started    time.Time  // when the last start scaled up
+	lastError  string     // of polling, logged once
+}
+
+// Options are the options of a KubernetesServer.
+type Options struct {
+	// API is the URL of the Kubernetes API, by default of the cluster, with
+	// the service account token in TokenFile and CA certificate in CAFile
+	// by default
+	API       string
+	TokenFile string
+	CAFile    string
+
+	// StatefulSet is the name of the StatefulSet in Namespace, by default of
+	// the service account, inspected every Interval
+	Namespace   string
+	StatefulSet string
+	Interval    time.Duration
+
+	// Rcon executes commands
+	Rcon *rcon.Conn
+
+	// StopTimeout fails stops taking longer
+	StopTimeout time.Duration
+}
+
+// NewKubernetesServer returns a new KubernetesServer, polling its state.
+func NewKubernetesServer(
+	logger *log.Logger,
+	options Options,
+) *KubernetesServer {
+
+	if options.TokenFile == "" {
+		options.TokenFile = filepath.Join(serviceAccountDir, "token")
+	}
+	if options.CAFile == "" {
+		options.CAFile = filepath.Join(serviceAccountDir, "ca.crt")
+	}
+	if options.Namespace == "" {
+		options.Namespace = inClusterNamespace()
+	}
+
+	s := KubernetesServer{}
+	s.states = serverPkg.NewStateMachine(serverPkg.Stopped)
+	s.logger = logger
+	s.client = NewClient(options.API, options.TokenFile, options.CAFile)
+	s.options = options
+	s.closed = make(chan struct{})
+	go s.poll()
+	return &s
+
+}
+
+// Start implements server.Server by scaling the StatefulSet to 1 replica.
+// The server is running once its pod is ready.
+func (s *KubernetesServer) Start() error {
+
+	// State changes hold mu
+	s.mu.Lock()
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err == nil {
+		s.scaling = true
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = s.scale(1)
+	if err != nil {
+		s.logger.Printf("error starting server: %s\n", err)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.scaling = false
+		if s.states.State() == serverPkg.Starting {
+			reason := fmt.Sprintf("start failed: %s", err)
+			s.states.Set(serverPkg.Stopped, reason)
+		}
+		return err
+	}
+
+	s.logger.Println("scaled to 1 replica")
+	s.mu.Lock()
+	s.scaling = false
+	s.started = time.Now()
+	s.mu.Unlock()
+	return nil
+
+}
+
+// Stop implements server.Server by scaling the StatefulSet to 0 replicas and
+// waiting until the pod is gone. Stopping a stopping server waits for it to
+// stop.
+func (s *KubernetesServer) Stop() error {
+
+	err := func() error {
+
+		// State changes hold mu
+		s.mu.Lock()
+		state := s.states.State()
+		var err error
+		switch state {
+		case serverPkg.Stopped:
+			err = serverPkg.ErrStopped
+		case serverPkg.Starting, serverPkg.Running:
+			err = s.states.Transition(
+				state,
+				serverPkg.Stopping,
+				"stop requested",
+			)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		// Stop unless another stop does
+		if state != serverPkg.Stopping {
+			err := s.scale(0)
+			if err != nil {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				reason := fmt.Sprintf("stop failed: %s", err)
+				s.states.Transition(
+					serverPkg.Stopping,
+					serverPkg.Running,
+					reason,
+				)
+				return err
+			}
+			s.logger.Println("scaled to 0 replicas")
+		}
+
+		// Wait until the poll finds the pod gone
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			s.options.StopTimeout,
+		)
+		defer cancel()
+		_, err = s.states.Wait(ctx, serverPkg.Stopped)
+		if err == nil {
+			return nil
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		reason := fmt.Sprintf(
+			"stop timed out after %s",
+			s.options.StopTimeout,
+		)
+		s.states.Transition(serverPkg.Stopping, serverPkg.Running, reason)
+		return errors.New(reason)
+
+	}()
+	if err != nil {
+		s.logger.Printf("error stopping server: %s\n", err)
+	}
+
+	return err
+
+}
+
+// Execute implements server.Server over RCON.
+func (s *KubernetesServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	// Check for error case
+	if s.states.State() != serverPkg.Running {
+		return "", fmt.Errorf("tried to execute on server that is not running")
+	}
+
+	return s.options.Rcon.Execute(ctx, command)
+
+}
+
+// State implements server.Server.
+func (s *KubernetesServer) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *KubernetesServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements server.Uptimer, from when the pod became ready.
+func (s *KubernetesServer) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states.State() != serverPkg.Running {
+		return 0
+	}
+	return time.Since(s.readySince)
+}
+
+// scale sets the replicas of the StatefulSet.
+func (s *KubernetesServer) scale(replicas int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return s.client.Scale(
+		ctx,
+		s.options.Namespace,
+		s.options.StatefulSet,
+		replicas,
+	)
+}
+
+// Close implements server.Closer by ending the polling and closing the RCON
+// connection.
+func (s *KubernetesServer) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	if s.options.Rcon != nil {
+		s.options.Rcon.Close()
+	}
+	return nil
+}
+
+// poll updates the state from the StatefulSet every interval, until closed.
+func (s *KubernetesServer) poll() {
+
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.update()
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+	}
+
+}
+
+// update inspects the StatefulSet and follows its state, which is kept if it
+// cannot be inspected.
+func (s *KubernetesServer) update() {
+
+	inspected := time.Now()
+	target, reason, readySince, err := s.inspect()
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Log errors once until they change
+	if err != nil {
+		if err.Error() != s.lastError {
+			s.logger.Printf("error inspecting statefulset: %s\n", err)
+		}
+		s.lastError = err.Error()
+		return
+	}
+	s.lastError = ""
+
+	// Starts ignore inspections before they scaled up, stopping servers
+	// wait to be stopped, stopped servers wait for terminating pods, and
+	// running servers stay running while their pod is not ready, as
+	// following them to starting would stop them first
+	state := s.states.State()
+	switch {
+	case state == serverPkg.Stopped && target == serverPkg.Stopping:
+		return
+	case state == serverPkg.Starting &&
+		(s.scaling || inspected.Before(s.started)):
+		return
+	case state == serverPkg.Stopping && target != serverPkg.Stopped:
+		return
+	case state == serverPkg.Running && target == serverPkg.Starting:
+		return
+	}
+	s.readySince = readySince
+	s.states.Follow(target, reason)
+
+}
+
+// inspect returns the server state of the StatefulSet and the reason for it,
+// and when its pod became ready.
+func (s *KubernetesServer) inspect() (
+	serverPkg.ServerState,
+	string,
+	time.Time,
+	error,
+) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	set, err := s.client.StatefulSet(
+		ctx,
+		s.options.Namespace,
+		s.options.StatefulSet,
+	)
+	if err != nil {
+		return 0, "", time.Time{}, fmt.Errorf(
+			"statefulset %s/%s: %s",
+			s.options.Namespace,
+			s.options.StatefulSet,
+			err,
+		)
+	}
+
+	// The pod of the single replica
+	pod, err := s.client.Pod(
+		ctx,
+		s.options.Namespace,
+		s.options.StatefulSet+"-0",
+	)
+	found := err == nil
+	if err != nil && !errors.Is(err, errNotFound) {
+		return 0, "", time.Time{}, err
+	}
+	ready, since := pod.Ready()
+
+	switch {
+	case set.Spec.Replicas == 0 && !found:
+		return serverPkg.Stopped, "scaled to 0 replicas", since, nil
+	case set.Spec.Replicas == 0:
+		return serverPkg.Stopping, "pod terminating", since, nil
+	case !found || pod.Metadata.DeletionTimestamp != nil:
+		return serverPkg.Starting, "pod pending", since, nil
+	case !ready:
+		return serverPkg.Starting, "pod not ready", since, nil
+	}
+	return serverPkg.Running, "pod ready", since, nil
+
+}
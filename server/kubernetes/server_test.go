@@ -0,0 +1,300 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// A fakeAPI is a fake Kubernetes API with one StatefulSet of one replica at
+// most.
+type fakeAPI struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	token       string
+	replicas    int
+	pod         bool // exists
+	ready       bool
+	terminating bool
+	readySince  time.Time
+	requests    []string // by method and path
+}
+
+// newFakeAPI returns a new fakeAPI accepting a token, with the StatefulSet
+// games/mc scaled to 0.
+func newFakeAPI(t *testing.T, token string) *fakeAPI {
+	a := fakeAPI{}
+	a.token = token
+	a.Server = httptest.NewServer(http.HandlerFunc(a.handle))
+	t.Cleanup(a.Close)
+	return &a
+}
+
+// handle handles a request of the API.
+func (a *fakeAPI) handle(w http.ResponseWriter, r *http.Request) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("Authorization") != "Bearer "+a.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Unauthorized",
+		})
+		return
+	}
+
+	set := statefulSetPath("games", "mc")
+	switch {
+
+	case r.Method == http.MethodGet && r.URL.Path == set:
+		var s StatefulSet
+		s.Spec.Replicas = a.replicas
+		json.NewEncoder(w).Encode(s)
+
+	case r.Method == http.MethodPatch && r.URL.Path == set+"/scale":
+		var patch StatefulSet
+		err := json.NewDecoder(r.Body).Decode(&patch)
+		if err != nil ||
+			r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		a.replicas = patch.Spec.Replicas
+		if a.replicas == 1 && !a.pod {
+			a.pod, a.ready, a.terminating = true, false, false
+		}
+		if a.replicas == 0 && a.pod {
+			a.terminating = true
+		}
+		json.NewEncoder(w).Encode(patch)
+
+	case r.Method == http.MethodGet &&
+		r.URL.Path == "/api/v1/namespaces/games/pods/mc-0" && a.pod:
+		json.NewEncoder(w).Encode(a.podObject())
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+
+	}
+
+}
+
+// podObject returns the pod. Must hold mu.
+func (a *fakeAPI) podObject() map[string]interface{} {
+
+	status := "False"
+	if a.ready {
+		status = "True"
+	}
+	metadata := map[string]interface{}{"name": "mc-0"}
+	if a.terminating {
+		metadata["deletionTimestamp"] = time.Now()
+	}
+
+	return map[string]interface{}{
+		"metadata": metadata,
+		"status": map[string]interface{}{
+			"conditions": []map[string]interface{}{{
+				"type":               "Ready",
+				"status":             status,
+				"lastTransitionTime": a.readySince,
+			}},
+		},
+	}
+
+}
+
+// setPod sets if the pod exists and is ready.
+func (a *fakeAPI) setPod(exists bool, ready bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pod = exists
+	a.ready = ready
+	a.terminating = false
+	if ready {
+		a.readySince = time.Now().Add(-time.Minute).Truncate(time.Second)
+	}
+}
+
+// newTestServer returns a new KubernetesServer of the StatefulSet games/mc
+// of a fake API, with a token, closed when the test ends.
+func newTestServer(
+	t *testing.T,
+	a *fakeAPI,
+	token string,
+) *KubernetesServer {
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(tokenFile, []byte(token+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewKubernetesServer(
+		log.New(io.Discard, "", 0),
+		Options{
+			API:         a.URL,
+			TokenFile:   tokenFile,
+			CAFile:      filepath.Join(t.TempDir(), "ca.crt"),
+			Namespace:   "games",
+			StatefulSet: "mc",
+			Interval:    10 * time.Millisecond,
+			StopTimeout: 5 * time.Second,
+		},
+	)
+	t.Cleanup(func() { s.Close() })
+	return s
+
+}
+
+// collect returns the new states of a canceled subscription.
+func collect(events <-chan serverPkg.StateEvent) string {
+	var states []string
+	for event := range events {
+		states = append(states, event.New.String())
+	}
+	return strings.Join(states, " ")
+}
+
+func TestLifecycle(t *testing.T) {
+
+	a := newFakeAPI(t, "secret")
+	s := newTestServer(t, a, "secret")
+	events, cancel := s.Subscribe()
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+
+	// Running once the pod is ready
+	time.Sleep(50 * time.Millisecond)
+	if s.State() != serverPkg.Starting {
+		t.Errorf("server with pod not ready is %s", s.State())
+	}
+	a.setPod(true, true)
+	servertest.Wait(t, s, serverPkg.Running)
+	if uptime := s.Uptime(); uptime < time.Minute {
+		t.Errorf("uptime is %s, want since the pod is ready", uptime)
+	}
+
+	// Stops wait for the pod to be gone
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		a.setPod(false, false)
+	}()
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", s.State())
+	}
+
+	cancel()
+	want := "starting running stopping stopped"
+	if got := collect(events); got != want {
+		t.Errorf("got states %s, want %s", got, want)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	patches := 0
+	for _, request := range a.requests {
+		if strings.HasPrefix(request, http.MethodPatch) {
+			patches++
+		}
+	}
+	if patches != 2 {
+		t.Errorf("got %d scale requests, want 2", patches)
+	}
+
+}
+
+func TestPodNotReadyAfterRunning(t *testing.T) {
+
+	a := newFakeAPI(t, "secret")
+	a.replicas = 1
+	a.setPod(true, true)
+	s := newTestServer(t, a, "secret")
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// Not ready or recreated pods do not stop the server
+	events, cancel := s.Subscribe()
+	a.setPod(true, false)
+	time.Sleep(50 * time.Millisecond)
+	a.setPod(false, false)
+	time.Sleep(50 * time.Millisecond)
+	if s.State() != serverPkg.Running {
+		t.Errorf("server with pod not ready is %s", s.State())
+	}
+	a.setPod(true, true)
+	time.Sleep(50 * time.Millisecond)
+
+	// Scaled to 0 by other tooling
+	a.mu.Lock()
+	a.replicas = 0
+	a.mu.Unlock()
+	a.setPod(false, false)
+	servertest.Wait(t, s, serverPkg.Stopped)
+
+	cancel()
+	if got := collect(events); got != "stopped" {
+		t.Errorf("got states %s, want stopped", got)
+	}
+
+}
+
+func TestBadToken(t *testing.T) {
+
+	a := newFakeAPI(t, "secret")
+	s := newTestServer(t, a, "wrong")
+
+	err := s.Start()
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("start: got %v, want unauthorized", err)
+	}
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after failed start is %s", s.State())
+	}
+
+}
+
+func TestCloseEndsPolling(t *testing.T) {
+
+	a := newFakeAPI(t, "secret")
+	a.replicas = 1
+	a.setPod(true, true)
+	s := newTestServer(t, a, "secret")
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// The state is no longer updated, once a poll in flight is done
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	time.Sleep(5 * s.options.Interval)
+	a.mu.Lock()
+	a.replicas = 0
+	a.mu.Unlock()
+	a.setPod(false, false)
+	time.Sleep(10 * s.options.Interval)
+	if state := s.State(); state != serverPkg.Running {
+		t.Errorf("closed server is %s", state)
+	}
+
+}
@@ -0,0 +1,50 @@
+package process
+
+import (
+	"regexp"
+	"strings"
+)
+
+// commandThread is the thread logging command output.
+const commandThread = "Server thread"
+
+// unknownCommand is the output line before an unknown command, such as the
+// end marker of a command.
+const unknownCommand = "Unknown or incomplete command, see below for error"
+
+// endMarkerPrefix is the prefix of the unknown command sent after a command,
+// whose error marks the end of the output of the command.
+const endMarkerPrefix = "golem-end-"
+
+// outputBuffer is the number of output lines buffered for a command, more
+// are dropped.
+const outputBuffer = 1024
+
+// consolePattern matches console lines such as
+// "[12:00:00] [Server thread/INFO]: message", capturing the thread and the
+// message.
+var consolePattern = regexp.MustCompile(`^\[[^\]]*\] \[([^\]/]+)/[A-Z]+\]: (.*)$`)
+
+// commandOutput returns the message of a console line if it can be command
+// output, which is logged by the server thread. Lines of unknown format are
+// kept as is.
+func commandOutput(line string) (string, bool) {
+	match := consolePattern.FindStringSubmatch(line)
+	if match == nil {
+		return line, true
+	}
+	return match[2], match[1] == commandThread
+}
+
+// endMarker returns the marker of a command output message if it is the
+// error of an end marker.
+func endMarker(message string) (string, bool) {
+	if !strings.HasPrefix(message, endMarkerPrefix) {
+		return "", false
+	}
+	i := strings.Index(message, "<--")
+	if i < 0 {
+		return "", false
+	}
+	return message[:i], true
+}
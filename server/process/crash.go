@@ -0,0 +1,206 @@
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// crashReportsDir is the directory of crash reports in the server directory.
+const crashReportsDir = "crash-reports"
+
+// crashDescriptionPrefix is the prefix of the description line of a crash
+// report.
+const crashDescriptionPrefix = "Description: "
+
+// A RestartPolicy restarts a crashed server after Backoff, doubling up to
+// MaxBackoff on each consecutive crash, and gives up after MaxAttempts
+// restarts. Crashes are consecutive unless the server ran for ResetAfter.
+type RestartPolicy struct {
+	OnCrash     bool
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+	ResetAfter  time.Duration
+}
+
+// LastCrash implements server.CrashReporter.
+func (s *ProcessServer) LastCrash() (serverPkg.Crash, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crash == nil {
+		return serverPkg.Crash{}, false
+	}
+	return *s.crash, true
+}
+
+// crashed records a crash of the current process, with its exit reason
+// unless it wrote a crash report, and applies the restart policy. Must hold
+// mu.
+func (s *ProcessServer) crashed(exitReason string) *serverPkg.Crash {
+
+	crash := serverPkg.Crash{}
+	crash.Time = time.Now()
+	crash.Reason = exitReason
+
+	// Prefer the description of a crash report of this process
+	report, description, err := readCrashReport(
+		s.serverDirectory,
+		s.startTime,
+	)
+	if err != nil {
+		s.logger.Printf("error reading crash report: %s\n", err)
+	}
+	if description != "" {
+		crash.Reason = description
+		crash.Report = report
+	}
+	s.logger.Printf("server crashed: %s\n", crash.Reason)
+
+	// Count consecutive crashes
+	policy := s.options.Restart
+	if time.Since(s.runningSince) >= policy.ResetAfter {
+		s.restarts = 0
+	}
+	if !policy.OnCrash {
+		s.crash = &crash
+		return s.crash
+	}
+	if s.restarts >= policy.MaxAttempts {
+		s.logger.Printf(
+			"crash loop, giving up after %d restarts\n",
+			s.restarts,
+		)
+		crash.GaveUp = true
+		s.crash = &crash
+		return s.crash
+	}
+
+	// Restart after the backoff, unless started or stopped meanwhile
+	backoff := s.backoff()
+	s.restarts++
+	s.logger.Printf(
+		"restarting server in %s (attempt %d of %d)\n",
+		backoff,
+		s.restarts,
+		policy.MaxAttempts,
+	)
+	s.restartID++
+	id := s.restartID
+	s.restartTimer = time.AfterFunc(backoff, func() {
+		s.restart(id)
+	})
+
+	s.crash = &crash
+	return s.crash
+
+}
+
+// backoff returns the wait before the next restart, doubling on each
+// consecutive crash up to the maximum. Must hold mu.
+func (s *ProcessServer) backoff() time.Duration {
+	policy := s.options.Restart
+	backoff := policy.Backoff << s.restarts
+	if backoff > policy.MaxBackoff || backoff <= 0 {
+		backoff = policy.MaxBackoff
+	}
+	return backoff
+}
+
+// restart restarts a crashed server when the restart timer of an id fires,
+// unless the restart was canceled.
+func (s *ProcessServer) restart(id int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.restartTimer == nil || s.restartID != id {
+		return
+	}
+	s.restartTimer = nil
+
+	err := s.start()
+	if err != nil && !errors.Is(err, serverPkg.ErrNotStopped) {
+		s.logger.Printf("error restarting server: %s\n", err)
+	}
+
+}
+
+// cancelRestart cancels a pending restart after a crash. Must hold mu.
+func (s *ProcessServer) cancelRestart() {
+	if s.restartTimer != nil {
+		s.restartTimer.Stop()
+		s.restartTimer = nil
+	}
+}
+
+// Close implements server.Closer by canceling a pending restart after a
+// crash.
+func (s *ProcessServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelRestart()
+	return nil
+}
+
+// readCrashReport returns the newest crash report in a server directory
+// modified since a time, and its description, or empty strings if there is
+// none.
+func readCrashReport(directory string, since time.Time) (string, string, error) {
+
+	dir := filepath.Join(directory, crashReportsDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// Find the newest report
+	var newest string
+	var newestTime time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".txt") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(since) || info.ModTime().Before(newestTime) {
+			continue
+		}
+		newest = filepath.Join(dir, entry.Name())
+		newestTime = info.ModTime()
+	}
+	if newest == "" {
+		return "", "", nil
+	}
+
+	f, err := os.Open(newest)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, crashDescriptionPrefix) {
+			return newest, strings.TrimPrefix(line, crashDescriptionPrefix), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return newest, "", err
+	}
+
+	return newest, "", fmt.Errorf("%s: no description", newest)
+
+}
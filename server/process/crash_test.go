@@ -0,0 +1,130 @@
+package process
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// newCrashingServer returns a new running ProcessServer of a fake server
+// that restarts after crashes, and a function crashing it.
+func newCrashingServer(
+	t *testing.T,
+	backoff time.Duration,
+) (*ProcessServer, func()) {
+
+	s := newTestServer(t, "ready")
+	s.options.Restart = RestartPolicy{
+		OnCrash:     true,
+		Backoff:     backoff,
+		MaxBackoff:  backoff,
+		MaxAttempts: 3,
+		ResetAfter:  time.Hour,
+	}
+	t.Cleanup(func() { s.Stop() })
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+
+	crash := func() {
+		s.mu.Lock()
+		err := s.process.Kill()
+		s.mu.Unlock()
+		if err != nil {
+			t.Fatalf("kill: %s", err)
+		}
+		servertest.Wait(t, s, serverPkg.Stopped)
+		if _, ok := s.LastCrash(); !ok {
+			t.Fatal("no crash after process was killed")
+		}
+	}
+	return s, crash
+
+}
+
+func TestCrashRestarts(t *testing.T) {
+
+	s, crash := newCrashingServer(t, 10*time.Millisecond)
+	crash()
+	servertest.Wait(t, s, serverPkg.Running)
+
+	s.mu.Lock()
+	restarts := s.restarts
+	s.mu.Unlock()
+	if restarts != 1 {
+		t.Errorf("got %d restarts, want 1", restarts)
+	}
+
+}
+
+func TestCrashRestartCanceled(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		cancel func(s *ProcessServer) error
+	}{
+		{"stop", func(s *ProcessServer) error {
+			err := s.Stop()
+			if errors.Is(err, serverPkg.ErrStopped) {
+				return nil
+			}
+			return err
+		}},
+		{"close", func(s *ProcessServer) error { return s.Close() }},
+	}
+
+	for _, test := range tests {
+
+		s, crash := newCrashingServer(t, 200*time.Millisecond)
+		crash()
+		err := test.cancel(s)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		// The server stays stopped after the backoff
+		time.Sleep(400 * time.Millisecond)
+		if state := s.State(); state != serverPkg.Stopped {
+			t.Errorf("%s: server is %s after the backoff", test.name, state)
+		}
+
+	}
+
+}
+
+func TestCrashBackoff(t *testing.T) {
+
+	s := ProcessServer{}
+	s.options.Restart = RestartPolicy{
+		Backoff:    time.Second,
+		MaxBackoff: 5 * time.Second,
+	}
+
+	// Doubling up to the maximum, also when the shift overflows
+	tests := []struct {
+		restarts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 5 * time.Second},
+		{10, 5 * time.Second},
+		{64, 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		s.restarts = test.restarts
+		if got := s.backoff(); got != test.want {
+			t.Errorf("after %d restarts: got %s, want %s",
+				test.restarts, got, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,227 @@
+package process
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// Files in the server directory of a detached process, which keeps running
+// when golem exits. Commands are written to the console FIFO and the output
+// is written to the log file, so a restarted golem can attach to both.
+const (
+	consoleFileName = "golem-console"
+	logFileName     = "golem-console.log"
+)
+
+// adoptPollInterval is the interval to check if an adopted process exited,
+// since it can not be waited for.
+const adoptPollInterval = time.Second
+
+// tailInterval is the interval to check the log file of a detached process
+// for new output.
+const tailInterval = 100 * time.Millisecond
+
+// Detached implements server.Detacher.
+func (s *ProcessServer) Detached() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.detached
+}
+
+// openDetached opens the console FIFO and truncates the log file of a
+// detached process.
+func (s *ProcessServer) openDetached() (*os.File, *os.File, error) {
+
+	console, err := openConsole(s.path(consoleFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log, err := os.OpenFile(
+		s.path(logFileName),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		console.Close()
+		return nil, nil, err
+	}
+
+	return console, log, nil
+
+}
+
+// adopt adopts the process of the pid file if it is still running, such as
+// after golem restarted. Detached processes are attached to their console and
+// log, others can only be signaled.
+func (s *ProcessServer) adopt() {
+
+	p, err := loadPidFile(s.serverDirectory)
+	if err != nil {
+		s.logger.Printf("error loading pid file: %s\n", err)
+		return
+	}
+	if p == nil {
+		return
+	}
+	if !p.running() {
+		err = p.remove()
+		if err != nil {
+			s.logger.Printf("error removing pid file: %s\n", err)
+		}
+		return
+	}
+	process, err := os.FindProcess(p.PID)
+	if err != nil {
+		s.logger.Printf("error adopting server: %s\n", err)
+		return
+	}
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Printf("adopting server process %d\n", p.PID)
+	s.process = process
+	s.pidFile = p
+	s.detached = p.Detached
+	s.adopted = true
+	s.exited = make(chan struct{})
+	s.startTime = p.Started
+	s.startPercent = -1
+	s.exitReason = ""
+
+	// Attach to the console and log of a detached process, checking the
+	// log for readiness
+	console := s.options.Ready.Strategy == ReadyConsole
+	ready := console && !s.detached
+	var offset int64
+	if s.detached {
+		f, err := openConsole(s.path(consoleFileName))
+		if err != nil {
+			s.logger.Printf("error opening console: %s\n", err)
+		} else {
+			s.stdin = f
+		}
+		offset, ready = s.scanLog()
+		ready = ready && console
+	}
+
+	// Set state to Starting, and to Running if known to be ready
+	s.states.Transition(serverPkg.Stopped, serverPkg.Starting, "adopted")
+	if ready {
+		s.states.Transition(serverPkg.Starting, serverPkg.Running, "adopted")
+		s.runningSince = time.Now()
+	}
+
+	// Start goroutines to follow the log and watch for process exit
+	pid := strconv.Itoa(p.PID)
+	if s.detached {
+		go s.tailLog(offset, pid, s.exited)
+	}
+	go s.watchExit(p.PID, s.exited)
+	if !console && !ready {
+		go s.probeReady(s.exited)
+	}
+
+}
+
+// scanLog reads the log of a detached process for the readiness pattern,
+// returning the offset to follow it from and if the pattern was found.
+func (s *ProcessServer) scanLog() (int64, bool) {
+
+	file, err := os.Open(s.path(logFileName))
+	if err != nil {
+		s.logger.Printf("error reading log: %s\n", err)
+		return 0, false
+	}
+	defer file.Close()
+
+	ready := false
+	pattern := s.options.Ready.Pattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		ready = ready || pattern != nil && pattern.MatchString(scanner.Text())
+	}
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		s.logger.Printf("error reading log: %s\n", err)
+	}
+	return offset, ready
+
+}
+
+// tailLog follows the log of a detached process from an offset, handling
+// lines as stdout until the process exits.
+func (s *ProcessServer) tailLog(
+	offset int64,
+	pid string,
+	exited chan struct{},
+) {
+
+	file, err := os.Open(s.path(logFileName))
+	if err != nil {
+		s.logger.Printf("error reading log: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		s.logger.Printf("error reading log: %s\n", err)
+		return
+	}
+
+	// Read lines until end of file, then wait for more, reading the rest
+	// once more after exit
+	reader := bufio.NewReader(file)
+	var line string
+	done := false
+	for {
+
+		part, err := reader.ReadString('\n')
+		line += part
+		if err == nil {
+			s.handleOutput(strings.TrimRight(line, "\r\n"), pid, true)
+			line = ""
+			continue
+		}
+		if err != io.EOF {
+			s.logger.Printf("error reading log: %s\n", err)
+			return
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-exited:
+			done = true
+		case <-time.After(tailInterval):
+		}
+
+	}
+
+}
+
+// watchExit polls an adopted process, which can not be waited for, until it
+// exits.
+func (s *ProcessServer) watchExit(pid int, exited chan struct{}) {
+	for processAlive(pid) {
+		time.Sleep(adoptPollInterval)
+	}
+	s.exit("process exited", exited)
+}
+
+// path returns the path of a file in the server directory.
+func (s *ProcessServer) path(name string) string {
+	return filepath.Join(s.serverDirectory, name)
+}
@@ -0,0 +1,61 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package process
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+func TestAdoptedStartNotRecorded(t *testing.T) {
+
+	// Start a server that is never ready by its console
+	first := newTestServer(t, "slow")
+	err := first.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+
+	// Adopt it, ready by a probe
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	s := NewProcessServer(
+		log.New(io.Discard, "", 0),
+		[]string{os.Args[0], "slow"},
+		first.serverDirectory,
+		Options{
+			Ready: Readiness{
+				Strategy: ReadyTCP,
+				Addr:     listener.Addr().String(),
+				Interval: 10 * time.Millisecond,
+			},
+			Stop: first.options.Stop,
+		},
+	)
+	if s.State() != serverPkg.Starting {
+		t.Fatalf("adopted server is %s, want starting", s.State())
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+
+	if n := len(s.startupHistory.Durations); n != 0 {
+		t.Errorf("got %d startup durations of adopted server, want 0", n)
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	servertest.Wait(t, first, serverPkg.Stopped)
+
+}
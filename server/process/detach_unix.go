@@ -0,0 +1,20 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// openConsole opens the console FIFO of a detached process, making it if
+// needed. It is opened for reading and writing, so the process never reads
+// end of file while golem is not running.
+func openConsole(path string) (*os.File, error) {
+	err := syscall.Mkfifo(path, 0600)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
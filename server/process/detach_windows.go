@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package process
+
+import (
+	"errors"
+	"os"
+)
+
+// openConsole returns an error, since there are no FIFOs.
+func openConsole(path string) (*os.File, error) {
+	return nil, errors.New("detaching is not supported on windows")
+}
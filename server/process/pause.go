@@ -0,0 +1,76 @@
+package process
+
+import (
+	"context"
+	"fmt"
+
+	serverPkg "golem/server"
+)
+
+// Pause implements server.Pauser by saving the world and stopping the
+// process group with SIGSTOP (not on Windows).
+func (s *ProcessServer) Pause() error {
+
+	err := func() error {
+
+		// No commands while saving and paused
+		s.executeMu.Lock()
+		defer s.executeMu.Unlock()
+
+		// Check for error case
+		if s.states.State() != serverPkg.Running {
+			return fmt.Errorf("tried to pause server that is not running")
+		}
+
+		if s.options.Stop.Save {
+			s.save(context.Background())
+		}
+
+		// State changes hold mu
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Unless stopped meanwhile
+		if s.states.State() != serverPkg.Running {
+			return fmt.Errorf("tried to pause server that is not running")
+		}
+
+		err := pauseProcessGroup(s.process)
+		if err != nil {
+			return err
+		}
+		s.logger.Println("paused server")
+		_, err = s.states.Set(serverPkg.Paused, "paused")
+		return err
+
+	}()
+	if err != nil {
+		s.logger.Printf("error pausing server: %s\n", err)
+	}
+
+	return err
+
+}
+
+// Resume implements server.Pauser by continuing the process group with
+// SIGCONT. Resuming a server that is not paused does nothing.
+func (s *ProcessServer) Resume() error {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.states.State() != serverPkg.Paused {
+		return nil
+	}
+
+	err := resumeProcessGroup(s.process)
+	if err != nil {
+		s.logger.Printf("error resuming server: %s\n", err)
+		return err
+	}
+	s.logger.Println("resumed server")
+	_, err = s.states.Set(serverPkg.Running, "resumed")
+	return err
+
+}
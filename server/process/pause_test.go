@@ -0,0 +1,43 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package process
+
+import (
+	"testing"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+func TestCrashWhilePaused(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	err = s.Pause()
+	if err != nil {
+		t.Fatalf("pause: %s", err)
+	}
+
+	// A paused process that is killed crashed
+	s.mu.Lock()
+	err = killProcessGroup(s.process)
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("kill: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Stopped)
+
+	crash, ok := s.LastCrash()
+	if !ok {
+		t.Fatal("no crash after paused process was killed")
+	}
+	if crash.GaveUp {
+		t.Error("crash gave up without restart policy")
+	}
+
+}
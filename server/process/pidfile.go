@@ -0,0 +1,130 @@
+package process
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pidFileName is the file in the server directory that records the running
+// process, so a restarted golem can adopt it.
+const pidFileName = "golem-server.pid"
+
+// A pidFile records a running process.
+type pidFile struct {
+	path     string
+	PID      int       `json:"pid"`
+	Args     []string  `json:"args"`
+	Started  time.Time `json:"started"`
+	Detached bool      `json:"detached"`
+}
+
+// loadPidFile reads the pid file of a server directory, or returns nil if
+// there is none.
+func loadPidFile(directory string) (*pidFile, error) {
+
+	p := pidFile{}
+	p.path = filepath.Join(directory, pidFileName)
+
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+
+}
+
+// save writes the pid file.
+func (p *pidFile) save() error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.path, data, 0644)
+}
+
+// remove removes the pid file.
+func (p *pidFile) remove() error {
+	err := os.Remove(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// running returns if the recorded process is still running. Where procfs is
+// available, the start time must match to not adopt a reused pid.
+func (p *pidFile) running() bool {
+
+	if !adoptable(p.PID) {
+		return false
+	}
+
+	started, ok := processStartTime(p.PID)
+	if !ok {
+		return true
+	}
+	d := started.Sub(p.Started)
+	return d < startTimeTolerance && d > -startTimeTolerance
+
+}
+
+// startTimeTolerance is the largest difference of the start time of a process
+// from procfs to the recorded start time.
+const startTimeTolerance = 5 * time.Second
+
+// clockTicks is the unit of times in procfs, which is 100 per second on
+// all common architectures.
+const clockTicks = 100
+
+// processStartTime returns the start time of a process from procfs, or false
+// if it is not available.
+func processStartTime(pid int) (time.Time, bool) {
+
+	// Boot time in seconds
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	var boot int64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			boot, err = strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if boot == 0 || err != nil {
+		return time.Time{}, false
+	}
+
+	// Start time in clock ticks since boot, the 22nd field, counting from
+	// after the command name which may contain spaces
+	data, err = os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	since := time.Duration(ticks) * time.Second / clockTicks
+	return time.Unix(boot, 0).Add(since), true
+
+}
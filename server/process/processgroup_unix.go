@@ -4,6 +4,7 @@
 package process
 
 import (
+	"os"
 	"syscall"
 )
 
@@ -12,3 +13,35 @@ func newProcessGroup() *syscall.SysProcAttr {
 		Setpgid: true,
 	}
 }
+
+// terminateProcessGroup sends SIGTERM to the process group of a process.
+func terminateProcessGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup kills the process group of a process.
+func killProcessGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// pauseProcessGroup stops the process group of a process with SIGSTOP.
+func pauseProcessGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGSTOP)
+}
+
+// resumeProcessGroup continues the process group of a process with SIGCONT.
+func resumeProcessGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGCONT)
+}
+
+// processAlive returns if a process exists and can be signaled.
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// adoptable returns if a process is alive and leads its process group, as
+// processes started by golem do.
+func adoptable(pid int) bool {
+	pgid, err := syscall.Getpgid(pid)
+	return processAlive(pid) && err == nil && pgid == pid
+}
@@ -4,6 +4,8 @@
 package process
 
 import (
+	"errors"
+	"os"
 	"syscall"
 )
 
@@ -12,3 +14,51 @@ func newProcessGroup() *syscall.SysProcAttr {
 		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
 	}
 }
+
+// terminateProcessGroup kills a process, since there is no SIGTERM.
+func terminateProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// killProcessGroup kills a process.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// errPauseUnsupported is returned when pausing, since there are no signals to
+// stop and continue processes.
+var errPauseUnsupported = errors.New("pausing is not supported on windows")
+
+// pauseProcessGroup returns errPauseUnsupported.
+func pauseProcessGroup(p *os.Process) error {
+	return errPauseUnsupported
+}
+
+// resumeProcessGroup returns errPauseUnsupported.
+func resumeProcessGroup(p *os.Process) error {
+	return errPauseUnsupported
+}
+
+// stillActive is the exit code of a process that has not exited.
+const stillActive = 259
+
+// processAlive returns if a process exists and has not exited.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(
+		syscall.PROCESS_QUERY_INFORMATION,
+		false,
+		uint32(pid),
+	)
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	err = syscall.GetExitCodeProcess(h, &code)
+	return err == nil && code == stillActive
+}
+
+// adoptable returns if a process is alive.
+func adoptable(pid int) bool {
+	return processAlive(pid)
+}
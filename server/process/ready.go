@@ -0,0 +1,80 @@
+package process
+
+import (
+	"net"
+	"regexp"
+	"time"
+
+	"golem/protocol"
+	serverPkg "golem/server"
+)
+
+// Readiness strategies
+const (
+	ReadyConsole = "console" // a console line matches a pattern
+	ReadyTCP     = "tcp"     // the server address accepts connections
+	ReadyStatus  = "status"  // the server address answers a status ping
+)
+
+// A Readiness decides when a starting server is running.
+type Readiness struct {
+	Strategy string
+	Pattern  *regexp.Regexp // console strategy
+
+	// Probe strategies connect to Addr every Interval, where status pings
+	// use ProtocolVersion
+	Addr            string
+	Interval        time.Duration
+	ProtocolVersion int
+}
+
+// probe returns if a server is ready by the probe strategy, and a reason.
+func (r Readiness) probe() (string, bool) {
+
+	switch r.Strategy {
+	case ReadyTCP:
+		conn, err := net.DialTimeout("tcp", r.Addr, r.Interval)
+		if err != nil {
+			return "", false
+		}
+		conn.Close()
+		return "tcp probe succeeded", true
+
+	case ReadyStatus:
+		_, err := protocol.QueryStatus(r.Addr, r.ProtocolVersion, r.Interval)
+		if err != nil {
+			return "", false
+		}
+		return "status probe succeeded", true
+	}
+
+	return "", false
+
+}
+
+// probeReady probes a starting process until it is ready, running or
+// exited.
+func (s *ProcessServer) probeReady(exited chan struct{}) {
+
+	ticker := time.NewTicker(s.options.Ready.Interval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		if s.states.State() != serverPkg.Starting {
+			return
+		}
+		if reason, ok := s.options.Ready.probe(); ok {
+			s.ready(reason)
+			return
+		}
+
+	}
+
+}
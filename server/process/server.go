@@ -2,32 +2,69 @@ package process
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	serverPkg "golem/server"
 )
 
 // A ProcessServer implements server.Server by supervising a process.
 type ProcessServer struct {
-	state serverPkg.ServerState
+	states *serverPkg.StateMachine
 
 	logger          *log.Logger
 	serverStartArgs []string
 	serverDirectory string
+	options         Options
+
+	mu             sync.Mutex // guards the current process and history
+	startupHistory *startupHistory
+	process        *os.Process
+	pidFile        *pidFile
+	detached       bool           // the process keeps running without golem
+	adopted        bool           // the process was started by another golem
+	stdin          io.WriteCloser // nil if there is no console
+	exited         chan struct{}  // closed when the process exits
+	runningSince   time.Time
+	startTime      time.Time
+	startPercent   int    // from the console, -1 if unknown
+	exitReason     string // why golem ended the process, if it did
+	crash          *serverPkg.Crash
+	restarts       int         // consecutive restarts after crashes
+	restartTimer   *time.Timer // pending restart after a crash, or nil
+	restartID      int         // of the latest restart timer
+
+	executeMu sync.Mutex // held while executing
+	executeID int
+	output    chan string // stdout lines while executing, or nil
+}
+
+// Options are the options of a ProcessServer.
+type Options struct {
+	// Ready decides when a starting server is running
+	Ready Readiness
+
+	// StartTimeout fails starts taking longer by killing the process, where
+	// zero disables it
+	StartTimeout time.Duration
+
+	// Stop is how the process is stopped
+	Stop StopSequence
 
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
-	stderr io.ReadCloser
-	wg     sync.WaitGroup
-	lines  chan string
-	exited chan bool
+	// Restart is how crashed servers are restarted
+	Restart RestartPolicy
+
+	// Detach starts the process with a console FIFO and a log file instead
+	// of pipes, so it keeps running when golem exits (not on Windows)
+	Detach bool
 }
 
 // NewProcessServer returns a new ProcessServer.
@@ -35,88 +72,175 @@ func NewProcessServer(
 	logger *log.Logger,
 	serverStartArgs []string,
 	serverDirectory string,
+	options Options,
 ) *ProcessServer {
 	s := ProcessServer{}
-	s.state = serverPkg.Stopped
+	s.states = serverPkg.NewStateMachine(serverPkg.Stopped)
 	s.logger = logger
 	s.serverStartArgs = serverStartArgs
 	s.serverDirectory = serverDirectory
-	s.lines = make(chan string)
+	s.options = options
+
+	// Load past startup durations for estimates
+	var err error
+	s.startupHistory, err = loadStartupHistory(serverDirectory)
+	if err != nil {
+		s.logger.Printf("error loading startup history: %s\n", err)
+	}
+
+	// Adopt a process left running by a previous golem
+	s.adopt()
+
 	return &s
 }
 
-// Start implements server.Server.
+// Start implements server.Server. Only one start is in flight at a time,
+// other starts return server.ErrNotStopped.
 func (s *ProcessServer) Start() error {
 
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelRestart()
+	return s.start()
+
+}
+
+// start starts the process. Must hold mu.
+func (s *ProcessServer) start() error {
+
+	// Set state to Starting
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err != nil {
+		return err
+	}
+
 	// Make the command
 	// Set process group (child process dies when parent process dies)
-	s.cmd = exec.Command(s.serverStartArgs[0], s.serverStartArgs[1:]...)
-	s.cmd.Dir = s.serverDirectory
-	s.cmd.SysProcAttr = newProcessGroup()
+	cmd := exec.Command(s.serverStartArgs[0], s.serverStartArgs[1:]...)
+	cmd.Dir = s.serverDirectory
+	cmd.SysProcAttr = newProcessGroup()
 
-	err := func() error {
+	err = func() error {
 
+		// Pipe stdin, stdout, and stderr, or use the console and log of a
+		// detached process
+		var stdin io.WriteCloser
+		var stdout, stderr io.Reader
 		var err error
+		if s.options.Detach {
+			console, logFile, err := s.openDetached()
+			if err != nil {
+				return err
+			}
+			defer logFile.Close() // the process has its own
+			cmd.Stdin = console
+			cmd.Stdout = logFile
+			cmd.Stderr = logFile
+			stdin = console
+		} else {
+			stdin, err = cmd.StdinPipe()
+			if err != nil {
+				return err
+			}
+			stdout, err = cmd.StdoutPipe()
+			if err != nil {
+				return err
+			}
+			stderr, err = cmd.StderrPipe()
+			if err != nil {
+				return err
+			}
+		}
 
-		// Pipe stdin, stdout, and stderr
-		s.stdin, err = s.cmd.StdinPipe()
+		// Start the command
+		err = cmd.Start()
 		if err != nil {
+			stdin.Close()
 			return err
 		}
-		s.stdout, err = s.cmd.StdoutPipe()
-		if err != nil {
-			return err
+
+		s.process = cmd.Process
+		s.detached = s.options.Detach
+		s.adopted = false
+		s.stdin = stdin
+		s.exited = make(chan struct{})
+		s.startTime = time.Now()
+		s.startPercent = -1
+		s.exitReason = ""
+
+		// Start goroutines to listen to output from stdout, stdout, or
+		// the log, and watch for process exit
+		var wg sync.WaitGroup
+		pid := strconv.Itoa(cmd.Process.Pid)
+		if s.detached {
+			go s.tailLog(0, pid, s.exited)
+		} else {
+			wg.Add(2)
+			go s.listenOutput(stdout, pid, true, &wg)
+			go s.listenOutput(stderr, pid, false, &wg)
 		}
-		s.stderr, err = s.cmd.StderrPipe()
+		go s.listenExit(cmd, s.exited, &wg)
+
+		// Record the process to adopt it after golem restarts
+		s.pidFile = &pidFile{
+			path:     s.path(pidFileName),
+			PID:      cmd.Process.Pid,
+			Args:     s.serverStartArgs,
+			Started:  s.startTime,
+			Detached: s.detached,
+		}
+		err = s.pidFile.save()
 		if err != nil {
-			return err
+			s.logger.Printf("error saving pid file: %s\n", err)
 		}
 
-		// Start goroutines to listen to output from stdout, stdout,
-		// and watch for process exit
-		s.wg.Add(2)
-		go s.listenOutput(s.stdout, true)
-		go s.listenOutput(s.stderr, false)
-		go s.listenExit()
-
-		// Start the command
-		return s.cmd.Start()
+		// Probe readiness and limit the start duration if enabled
+		if s.options.Ready.Strategy != ReadyConsole {
+			go s.probeReady(s.exited)
+		}
+		if s.options.StartTimeout > 0 {
+			exited := s.exited
+			time.AfterFunc(s.options.StartTimeout, func() {
+				s.startTimedOut(exited)
+			})
+		}
+		return nil
 
 	}()
 	if err != nil {
 		s.logger.Printf("error starting server: %s\n", err)
+		s.states.Set(serverPkg.Stopped, fmt.Sprintf("start failed: %s", err))
 	}
 
-	// Set state to Starting
-	s.state = serverPkg.Starting
-
 	return err
 
 }
 
-// Stop implements server.Server.
+// Stop implements server.Server with the stop sequence of the options.
+// Stopping a stopping server waits for it to exit, and paused servers are
+// resumed to stop without saving again.
 func (s *ProcessServer) Stop() error {
 
 	err := func() error {
 
-		// Check for error cases
-		switch {
-		case s.state == serverPkg.Stopped:
-			return fmt.Errorf("tried to stop stopped server")
-		case s.cmd == nil || s.cmd.Process == nil:
-			return fmt.Errorf("tried to stop server with missing process")
-		}
-
-		// Execute Minecraft stop command
-		_, err := s.Execute(serverPkg.StopCommand)
+		from, exited, err := s.stopping()
 		if err != nil {
 			return err
 		}
 
-		// Set state to Stopping
-		// Wait for process exit
-		s.state = serverPkg.Stopping
-		<-s.exited
+		// Wait for process exit if another stop runs the sequence
+		if from == serverPkg.Stopping {
+			<-exited
+			return nil
+		}
+
+		s.stopSequence(from == serverPkg.Running)
 		return nil
 
 	}()
@@ -128,95 +252,315 @@ func (s *ProcessServer) Stop() error {
 
 }
 
-// Execute implements server.Server.
-func (s *ProcessServer) Execute(command string) (string, error) {
+// stopping sets the state to Stopping unless already stopping. Returns the
+// previous state and a channel closed when the process exits.
+func (s *ProcessServer) stopping() (
+	serverPkg.ServerState,
+	chan struct{},
+	error,
+) {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Stopped servers stay stopped, even after a crash
+	s.cancelRestart()
+
+	state := s.states.State()
+	switch state {
+	case serverPkg.Stopped:
+		return state, nil, serverPkg.ErrStopped
+	case serverPkg.Stopping:
+		return state, s.exited, nil
+	case serverPkg.Paused:
+		// Continue the process so it can stop
+		err := resumeProcessGroup(s.process)
+		if err != nil {
+			s.logger.Printf("error resuming server: %s\n", err)
+		}
+	}
+
+	// Set state to Stopping
+	err := s.states.Transition(state, serverPkg.Stopping, "stop requested")
+	return state, s.exited, err
+
+}
+
+// Execute implements server.Server. Commands are executed one at a time,
+// each followed by an unknown command as an end marker, so the output is the
+// server thread lines until the error of the marker (Minecraft 1.13+).
+// Returns the output so far with the context error on timeout, and the
+// rest of its output is dropped by the next command.
+func (s *ProcessServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	// One command at a time
+	s.executeMu.Lock()
+	defer s.executeMu.Unlock()
 
 	// Check for error case
-	if s.state != serverPkg.Running {
+	if s.states.State() != serverPkg.Running {
 		return "", fmt.Errorf("tried to execute on server that is not running")
 	}
 
-	// Send command to stdin
-	_, err := s.stdin.Write([]byte(command + "\n"))
+	return s.execute(ctx, command)
+
+}
+
+// execute executes a command in any state. Must hold executeMu.
+func (s *ProcessServer) execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	// Collect stdout lines until done
+	s.mu.Lock()
+	stdin := s.stdin
+	exited := s.exited
+	output := make(chan string, outputBuffer)
+	s.output = output
+	s.executeID++
+	marker := endMarkerPrefix + strconv.Itoa(s.executeID)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.output = nil
+		s.mu.Unlock()
+	}()
+
+	// Send command and end marker to stdin
+	if stdin == nil {
+		return "", fmt.Errorf("server console is not available")
+	}
+	_, err := stdin.Write([]byte(command + "\n" + marker + "\n"))
 	if err != nil {
 		return "", err
 	}
 
-	// Wait for line from stdout
-	return <-s.lines, nil
+	var lines []string
+	for {
+
+		select {
+		case line := <-output:
+			message, ok := commandOutput(line)
+			if !ok {
+				continue
+			}
+			end, ok := endMarker(message)
+			if !ok {
+				lines = append(lines, message)
+				continue
+			}
+
+			// Drop the error line of the marker
+			if n := len(lines); n > 0 && lines[n-1] == unknownCommand {
+				lines = lines[:n-1]
+			}
+			if end == marker {
+				return strings.Join(lines, "\n"), nil
+			}
+
+			// Drop the output of a previous command that timed out
+			lines = nil
+
+		case <-exited:
+			return strings.Join(lines, "\n"), fmt.Errorf("server exited")
+		case <-ctx.Done():
+			return strings.Join(lines, "\n"), ctx.Err()
+		}
+
+	}
 
 }
 
 // State implements server.Server.
 func (s *ProcessServer) State() serverPkg.ServerState {
-	return s.state
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *ProcessServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements server.Uptimer.
+func (s *ProcessServer) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states.State() != serverPkg.Running {
+		return 0
+	}
+	return time.Since(s.runningSince)
+}
+
+// StartupProgress implements server.StartupReporter.
+func (s *ProcessServer) StartupProgress() (serverPkg.StartupProgress, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states.State() != serverPkg.Starting {
+		return serverPkg.StartupProgress{}, false
+	}
+	elapsed := time.Since(s.startTime)
+	return s.startupHistory.progress(elapsed, s.startPercent), true
 }
 
 // listenOutput listens to and handles the outputs of stdout and stder.
-func (s *ProcessServer) listenOutput(r io.Reader, stdout bool) {
+func (s *ProcessServer) listenOutput(
+	r io.Reader,
+	pid string,
+	stdout bool,
+	wg *sync.WaitGroup,
+) {
 
-	defer s.wg.Done()
+	defer wg.Done()
 
 	// Scan lines from reader
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
+		s.handleOutput(scanner.Text(), pid, stdout)
+	}
 
-		line := scanner.Text()
+}
 
-		// Log line
-		var pid string
-		if s.cmd == nil || s.cmd.Process == nil {
-			pid = "unknown"
-		} else {
-			pid = strconv.Itoa(s.cmd.Process.Pid)
+// handleOutput logs an output line of the process, interpreting stdout.
+func (s *ProcessServer) handleOutput(line string, pid string, stdout bool) {
+
+	// Log line
+	s.logger.Printf("[%s(%s)] %s", s.serverStartArgs[0], pid, line)
+
+	// Interpret line only for stdout
+	if !stdout {
+		return
+	}
+
+	// Track startup progress
+	starting := s.states.State() == serverPkg.Starting
+	if percent, ok := parseProgress(line); ok && starting {
+		s.mu.Lock()
+		s.startPercent = percent
+		s.mu.Unlock()
+	}
+
+	// Check if startup is complete
+	pattern := s.options.Ready.Pattern
+	if starting && pattern != nil && pattern.MatchString(line) {
+		s.ready("startup done")
+	}
+
+	// Send line to the executing command
+	s.mu.Lock()
+	output := s.output
+	s.mu.Unlock()
+	if output != nil {
+		select {
+		case output <- line:
+		default:
 		}
-		s.logger.Printf("[%s(%s)] %s", s.serverStartArgs[0], pid, line)
+	}
 
-		// Interpret line only for stdout
-		if stdout {
+}
 
-			// Check if startup is complete
-			if s.state == serverPkg.Starting &&
-				strings.Contains(line, "INFO") &&
-				strings.Contains(line, "Done") {
+// ready sets a starting server to Running and records the startup duration
+// unless the process was adopted.
+func (s *ProcessServer) ready(reason string) {
 
-				// Set state to Running
-				s.state = serverPkg.Running
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-			}
+	// Unless stopped meanwhile
+	err := s.states.Transition(serverPkg.Starting, serverPkg.Running, reason)
+	if err != nil {
+		return
+	}
 
-			// Signal line to channel
-			select {
-			case s.lines <- line:
-			default:
-			}
+	s.runningSince = time.Now()
+	s.crash = nil
 
-		}
+	// Only starts by golem are timed from the start
+	if s.adopted {
+		return
+	}
+	err = s.startupHistory.add(s.runningSince.Sub(s.startTime))
+	if err != nil {
+		s.logger.Printf("error saving startup history: %s\n", err)
+	}
+
+}
+
+// startTimedOut kills a process that is still starting after the start
+// timeout, failing the start.
+func (s *ProcessServer) startTimedOut(exited chan struct{}) {
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Unless it is another process, or no longer starting
+	if s.exited != exited || s.states.State() != serverPkg.Starting {
+		return
+	}
+
+	s.exitReason = fmt.Sprintf(
+		"start timed out after %s",
+		s.options.StartTimeout,
+	)
+	s.logger.Printf("%s, killing server\n", s.exitReason)
+	err := killProcessGroup(s.process)
+	if err != nil {
+		s.logger.Printf("error killing server: %s\n", err)
 	}
 
 }
 
 // listenExit listens for the process to exit.
-func (s *ProcessServer) listenExit() {
+func (s *ProcessServer) listenExit(
+	cmd *exec.Cmd,
+	exited chan struct{},
+	wg *sync.WaitGroup,
+) {
 
 	// Wait for stdout and strerr listeners
 	// Wait for process to exit
-	s.wg.Wait()
-	err := s.cmd.Wait()
+	wg.Wait()
+	reason := "process exited"
+	err := cmd.Wait()
 	if err != nil {
-		s.logger.Printf("server process exited with error: %s\n", err)
-	} else {
-		s.logger.Printf("server process exited")
+		reason = fmt.Sprintf("process exited with error: %s", err)
 	}
+	s.exit(reason, exited)
 
-	// Set state to Stopped
-	s.state = serverPkg.Stopped
+}
+
+// exit handles the exit of the process.
+func (s *ProcessServer) exit(reason string, exited chan struct{}) {
 
+	s.logger.Printf("server %s\n", reason)
+
+	s.mu.Lock()
+
+	// Forget the process
+	err := s.pidFile.remove()
+	if err != nil {
+		s.logger.Printf("error removing pid file: %s\n", err)
+	}
+	if s.detached && s.stdin != nil {
+		s.stdin.Close()
+	}
+
+	// Set state to Stopped
 	// Signal process exited
-	select {
-	case s.exited <- true:
-	default:
+	state := s.states.State()
+	switch {
+	case s.exitReason != "":
+		reason = s.exitReason
+	case state == serverPkg.Running || state == serverPkg.Paused:
+		// Exited on its own while running or paused
+		reason = "crashed: " + s.crashed(reason).Reason
 	}
+	s.states.Set(serverPkg.Stopped, reason)
+	s.mu.Unlock()
+	close(exited)
 
 }
@@ -0,0 +1,372 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// fakeServerEnv makes the test binary run as a fake Minecraft server.
+const fakeServerEnv = "GOLEM_FAKE_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) != "" {
+		fakeServer(os.Args[1])
+		os.Exit(0)
+	}
+	os.Setenv(fakeServerEnv, "1")
+	os.Exit(m.Run())
+}
+
+// fakeServer runs a fake Minecraft server console in a mode: "ready" is done
+// at once, "slow" never, and "stubborn" is done at once but does not stop.
+func fakeServer(mode string) {
+
+	logf := func(format string, v ...interface{}) {
+		fmt.Printf("[12:00:00] [Server thread/INFO]: "+format+"\n", v...)
+	}
+	logWorker := func(message string) {
+		fmt.Printf("[12:00:00] [Worker-Main-1/INFO]: %s\n", message)
+	}
+
+	logf("Starting minecraft server version 1.17.1")
+	if mode == "stubborn" {
+		stubbornServer(logf)
+	}
+	if mode == "ready" {
+		logf(`Done (1.0s)! For help, type "help"`)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		command := scanner.Text()
+		switch {
+		case command == serverPkg.StopCommand:
+			logf("Stopping the server")
+			return
+		case command == serverPkg.SaveCommand:
+			logf("Saved the game")
+		case command == "list":
+			logf("There are 0 of a max of 20 players online: ")
+		case strings.HasPrefix(command, "say "):
+			logf("[Server] %s", strings.TrimPrefix(command, "say "))
+
+		// Output interleaved with lines of other threads
+		case command == "noisy":
+			logWorker("Preparing spawn area: 0%")
+			logf("first line")
+			logWorker("Preparing spawn area: 50%")
+			logf("second line")
+
+		// Output with a pause, for timeouts
+		case command == "slow":
+			logf("before pause")
+			time.Sleep(500 * time.Millisecond)
+			logf("after pause")
+
+		default:
+			logf(unknownCommand)
+			logf("%s<--[HERE]", command)
+		}
+	}
+
+}
+
+// stubbornServer runs a fake server that is ready at once, but ignores its
+// console and SIGTERM, until killed.
+func stubbornServer(logf func(format string, v ...interface{})) {
+	signal.Ignore(syscall.SIGTERM)
+	logf(`Done (1.0s)! For help, type "help"`)
+	io.Copy(io.Discard, os.Stdin)
+	time.Sleep(time.Hour)
+}
+
+// newTestServer returns a new ProcessServer of a fake server in a mode.
+func newTestServer(t *testing.T, mode string) *ProcessServer {
+	return NewProcessServer(
+		log.New(io.Discard, "", 0),
+		[]string{os.Args[0], mode},
+		t.TempDir(),
+		Options{
+			Ready: Readiness{
+				Strategy: ReadyConsole,
+				Pattern:  regexp.MustCompile(`INFO.*Done`),
+			},
+			Stop: StopSequence{
+				Save:        true,
+				SaveTimeout: 5 * time.Second,
+				Timeout:     5 * time.Second,
+				TermTimeout: 5 * time.Second,
+				Deadline:    10 * time.Second,
+			},
+		},
+	)
+}
+
+func TestLifecycle(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	events, cancel := s.Subscribe()
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	err = s.Start()
+	if !errors.Is(err, serverPkg.ErrNotStopped) {
+		t.Errorf("second start: got %v, want ErrNotStopped", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	if s.Uptime() <= 0 {
+		t.Error("running server has no uptime")
+	}
+
+	ctx, cancelExecute := context.WithTimeout(
+		context.Background(),
+		5*time.Second,
+	)
+	defer cancelExecute()
+	output, err := s.Execute(ctx, "list")
+	want := "There are 0 of a max of 20 players online: "
+	if err != nil || output != want {
+		t.Errorf("execute: got %q, %v, want %q", output, err, want)
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", s.State())
+	}
+	if s.Uptime() != 0 {
+		t.Error("stopped server has uptime")
+	}
+	err = s.Stop()
+	if !errors.Is(err, serverPkg.ErrStopped) {
+		t.Errorf("second stop: got %v, want ErrStopped", err)
+	}
+
+	// Events come in order
+	cancel()
+	var got []string
+	for event := range events {
+		got = append(got, event.Old.String()+">"+event.New.String())
+	}
+	wantEvents := "stopped>starting starting>running running>stopping " +
+		"stopping>stopped"
+	if strings.Join(got, " ") != wantEvents {
+		t.Errorf("got events %v, want %s", got, wantEvents)
+	}
+
+	// Successful starts are recorded for estimates
+	if n := len(s.startupHistory.Durations); n != 1 {
+		t.Errorf("got %d startup durations, want 1", n)
+	}
+
+}
+
+func TestStopWhileStarting(t *testing.T) {
+
+	s := newTestServer(t, "slow")
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	progress, ok := s.StartupProgress()
+	if !ok || progress.Percent != -1 || progress.Remaining != -1 {
+		t.Errorf("startup progress: got %+v, %t", progress, ok)
+	}
+
+	s.mu.Lock()
+	pid := s.process.Pid
+	s.mu.Unlock()
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+
+	// The process exited before the stop returned
+	if s.State() != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", s.State())
+	}
+	if processAlive(pid) {
+		t.Error("process alive after stop")
+	}
+	if _, crashed := s.LastCrash(); crashed {
+		t.Error("stop was reported as crash")
+	}
+	if _, ok := s.StartupProgress(); ok {
+		t.Error("stopped server reports startup progress")
+	}
+
+	// Stopped starts are not recorded for estimates
+	if n := len(s.startupHistory.Durations); n != 0 {
+		t.Errorf("got %d startup durations, want 0", n)
+	}
+
+}
+
+func TestConcurrentStartStop(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+
+	for round := 0; round < 3; round++ {
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				err := s.Start()
+				if err != nil && !errors.Is(err, serverPkg.ErrNotStopped) {
+					t.Errorf("start: %s", err)
+				}
+				s.Uptime()
+				s.StartupProgress()
+			}()
+			go func() {
+				defer wg.Done()
+				err := s.Stop()
+				if err != nil && !errors.Is(err, serverPkg.ErrStopped) {
+					t.Errorf("stop: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Stops wait for the process to exit
+		err := s.Stop()
+		if err != nil && !errors.Is(err, serverPkg.ErrStopped) {
+			t.Fatalf("stop: %s", err)
+		}
+		if s.State() != serverPkg.Stopped {
+			t.Fatalf("state after stop is %s", s.State())
+		}
+
+	}
+
+}
+
+func TestConcurrentStops(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// Every stop returns once the process exited
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop()
+			if state := s.State(); state != serverPkg.Stopped {
+				t.Errorf("state after stop is %s", state)
+			}
+		}()
+	}
+	wg.Wait()
+
+}
+
+func TestConcurrentExecute(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	defer s.Stop()
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// Every command gets its own output
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(
+				context.Background(),
+				5*time.Second,
+			)
+			defer cancel()
+			output, err := s.Execute(ctx, fmt.Sprintf("say %d", i))
+			want := fmt.Sprintf("[Server] %d", i)
+			if err != nil || output != want {
+				t.Errorf("execute: got %q, %v, want %q", output, err, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+}
+
+func TestExecuteIgnoresOtherThreads(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	defer s.Stop()
+	servertest.Wait(t, s, serverPkg.Running)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := s.Execute(ctx, "noisy")
+	want := "first line\nsecond line"
+	if err != nil || output != want {
+		t.Errorf("execute: got %q, %v, want %q", output, err, want)
+	}
+
+}
+
+func TestExecuteCanceled(t *testing.T) {
+
+	s := newTestServer(t, "ready")
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	defer s.Stop()
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// The output so far is returned with the context error
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		100*time.Millisecond,
+	)
+	defer cancel()
+	output, err := s.Execute(ctx, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) || output != "before pause" {
+		t.Errorf("canceled execute: got %q, %v", output, err)
+	}
+
+	// The rest of its output is dropped by the next command
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err = s.Execute(ctx, "say next")
+	if err != nil || output != "[Server] next" {
+		t.Errorf("next execute: got %q, %v", output, err)
+	}
+
+}
@@ -0,0 +1,125 @@
+package process
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// startupHistoryFile is the file in the server directory that keeps the
+// durations of past starts.
+const startupHistoryFile = "golem-startup.json"
+
+// startupHistoryLength is the number of past starts kept.
+const startupHistoryLength = 10
+
+// progressPattern matches startup progress lines in the console output.
+var progressPattern = regexp.MustCompile(`Preparing spawn area: (\d+)%`)
+
+// A startupHistory is the durations of past starts, persisted to a file.
+type startupHistory struct {
+	path      string
+	Durations []time.Duration `json:"durations"`
+}
+
+// loadStartupHistory reads the startup history of a server directory, or
+// returns an empty history if there is none.
+func loadStartupHistory(directory string) (*startupHistory, error) {
+
+	h := startupHistory{}
+	h.path = filepath.Join(directory, startupHistoryFile)
+
+	data, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return &h, nil
+	}
+	if err != nil {
+		return &h, err
+	}
+
+	err = json.Unmarshal(data, &h)
+	return &h, err
+
+}
+
+// add adds the duration of a start and saves the history.
+func (h *startupHistory) add(d time.Duration) error {
+
+	h.Durations = append(h.Durations, d)
+	if len(h.Durations) > startupHistoryLength {
+		h.Durations = h.Durations[len(h.Durations)-startupHistoryLength:]
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+
+}
+
+// estimate returns the expected duration of a start, the average of past
+// starts, or false if there are none.
+func (h *startupHistory) estimate() (time.Duration, bool) {
+
+	if len(h.Durations) == 0 {
+		return 0, false
+	}
+
+	var sum time.Duration
+	for _, d := range h.Durations {
+		sum += d
+	}
+	return sum / time.Duration(len(h.Durations)), true
+
+}
+
+// progress returns the progress of a start from its elapsed time and the
+// last progress percent from the console, or -1 if there is none.
+func (h *startupHistory) progress(
+	elapsed time.Duration,
+	consolePercent int,
+) serverPkg.StartupProgress {
+
+	p := serverPkg.StartupProgress{
+		Elapsed:   elapsed,
+		Percent:   consolePercent,
+		Remaining: -1,
+	}
+
+	estimate, ok := h.estimate()
+	if !ok {
+		return p
+	}
+
+	// Never claim to be done before the server is
+	p.Remaining = estimate - elapsed
+	if p.Remaining < 0 {
+		p.Remaining = 0
+	}
+	if p.Percent < 0 {
+		p.Percent = int(100 * elapsed / estimate)
+		if p.Percent > 99 {
+			p.Percent = 99
+		}
+	}
+
+	return p
+
+}
+
+// parseProgress returns the percent of a startup progress line, or false if
+// the line is not one.
+func parseProgress(line string) (int, bool) {
+	match := progressPattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, false
+	}
+	percent, err := strconv.Atoi(match[1])
+	return percent, err == nil
+}
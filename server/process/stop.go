@@ -0,0 +1,126 @@
+package process
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// savedMessage is the console message of a completed save.
+const savedMessage = "Saved the game"
+
+// A StopSequence is how a process is stopped, escalating from the Minecraft
+// stop command to signals, all within Deadline.
+type StopSequence struct {
+	// Save saves the world before stopping a running server, waiting for
+	// the save for at most SaveTimeout
+	Save        bool
+	SaveTimeout time.Duration
+
+	// Timeout is the wait after the stop command before SIGTERM to the
+	// process group, and TermTimeout the wait after SIGTERM before SIGKILL
+	Timeout     time.Duration
+	TermTimeout time.Duration
+
+	// Deadline is the longest the whole sequence takes before SIGKILL
+	Deadline time.Duration
+}
+
+// stopSequence stops the process by the stop sequence, returning once it
+// exited. Saves the world first if running.
+func (s *ProcessServer) stopSequence(running bool) {
+
+	sequence := s.options.Stop
+	ctx, cancel := context.WithTimeout(context.Background(), sequence.Deadline)
+	defer cancel()
+
+	s.mu.Lock()
+	process := s.process
+	stdin := s.stdin
+	exited := s.exited
+	s.mu.Unlock()
+
+	// wait waits for the process to exit for at most a timeout, or until the
+	// deadline, returning if it exited
+	wait := func(timeout time.Duration) bool {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-exited:
+			return true
+		case <-timer.C:
+		case <-ctx.Done():
+			s.logger.Printf("stop deadline of %s reached\n", sequence.Deadline)
+		}
+		return false
+	}
+
+	// Without a console, such as for adopted processes that are not
+	// detached, only signals are left
+	if stdin == nil {
+		s.logger.Println("server console is not available, using signals")
+	}
+
+	// Save unless paused, which saved already
+	if sequence.Save && running && stdin != nil {
+		s.executeMu.Lock()
+		s.save(ctx)
+		s.executeMu.Unlock()
+	}
+
+	// Send Minecraft stop command
+	if stdin != nil {
+		s.logger.Println("sending stop command")
+		_, err := stdin.Write([]byte(serverPkg.StopCommand + "\n"))
+		if err != nil {
+			s.logger.Printf("error sending stop command: %s\n", err)
+		}
+		if wait(sequence.Timeout) {
+			return
+		}
+	}
+
+	// Escalate to signals, at once without a console
+	if stdin != nil {
+		s.logger.Println("server did not stop, sending SIGTERM")
+	} else {
+		s.logger.Println("sending SIGTERM")
+	}
+	err := terminateProcessGroup(process)
+	if err != nil {
+		s.logger.Printf("error sending SIGTERM: %s\n", err)
+	}
+	if wait(sequence.TermTimeout) {
+		return
+	}
+
+	s.logger.Println("server did not stop, sending SIGKILL")
+	err = killProcessGroup(process)
+	if err != nil {
+		s.logger.Printf("error sending SIGKILL: %s\n", err)
+	}
+	<-exited
+
+}
+
+// save saves the world and checks the save is done, for at most the save
+// timeout, logging the result. Must hold executeMu.
+func (s *ProcessServer) save(ctx context.Context) {
+
+	s.logger.Println("saving the world")
+	ctx, cancel := context.WithTimeout(ctx, s.options.Stop.SaveTimeout)
+	defer cancel()
+
+	output, err := s.execute(ctx, serverPkg.SaveCommand)
+	switch {
+	case err != nil:
+		s.logger.Printf("error saving the world: %s\n", err)
+	case !strings.Contains(output, savedMessage):
+		s.logger.Println("error saving the world: no save confirmation")
+	default:
+		s.logger.Println("saved the world")
+	}
+
+}
@@ -0,0 +1,105 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package process
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// A logLines collects the lines of a logger.
+type logLines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Write implements io.Writer.
+func (l *logLines) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// String returns the lines collected so far, one per line.
+func (l *logLines) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+// newStubbornServer returns a new ProcessServer of a fake server ignoring
+// its console and SIGTERM, with short stop timeouts, and its log.
+func newStubbornServer(t *testing.T) (*ProcessServer, *logLines) {
+
+	logs := &logLines{}
+	s := newTestServer(t, "stubborn")
+	s.logger = log.New(logs, "", 0)
+	s.options.Stop = StopSequence{
+		Timeout:     200 * time.Millisecond,
+		TermTimeout: 200 * time.Millisecond,
+		Deadline:    10 * time.Second,
+	}
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	return s, logs
+
+}
+
+func TestStopEscalates(t *testing.T) {
+
+	s, logs := newStubbornServer(t)
+	s.mu.Lock()
+	pid := s.process.Pid
+	s.mu.Unlock()
+
+	err := s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if processAlive(pid) {
+		t.Error("process alive after stop")
+	}
+
+	want := "sending stop command\n" +
+		"server did not stop, sending SIGTERM\n" +
+		"server did not stop, sending SIGKILL"
+	if got := logs.String(); !strings.Contains(got, want) {
+		t.Errorf("got log:\n%s\nwant:\n%s", got, want)
+	}
+
+}
+
+func TestStopWithoutConsoleEscalates(t *testing.T) {
+
+	// As for adopted processes that are not detached
+	s, logs := newStubbornServer(t)
+	s.mu.Lock()
+	s.stdin = nil
+	s.mu.Unlock()
+
+	err := s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+
+	want := "server console is not available, using signals\n" +
+		"sending SIGTERM\n" +
+		"server did not stop, sending SIGKILL"
+	got := logs.String()
+	if !strings.Contains(got, want) || strings.Contains(got, "stop command") {
+		t.Errorf("got log:\n%s\nwant:\n%s", got, want)
+	}
+
+}
@@ -0,0 +1,275 @@
+package rcon
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RCON packet types
+const (
+	typeResponse = 0
+	typeCommand  = 2
+	typeLogin    = 3
+)
+
+// maxPacketLength is the largest RCON packet accepted, where responses of
+// Minecraft are split into bodies of at most 4096 bytes.
+const maxPacketLength = 4096 + 10
+
+// ErrAuth is returned by Dial when the password is wrong.
+var ErrAuth = errors.New("rcon authentication failed")
+
+// A Client is a connection to a Minecraft RCON server. It is safe for
+// concurrent use, executing one command at a time.
+type Client struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	id     int32
+}
+
+// Dial connects to an RCON server and logs in with a password.
+func Dial(
+	ctx context.Context,
+	addr string,
+	password string,
+) (*Client, error) {
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Client{}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	err = func() error {
+
+		c.setDeadline(ctx)
+		id, err := c.write(typeLogin, password)
+		if err != nil {
+			return err
+		}
+
+		// A failed login responds with id -1
+		responseID, _, err := c.read()
+		if err != nil {
+			return err
+		}
+		if responseID != id {
+			return ErrAuth
+		}
+		return nil
+
+	}()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &c, nil
+
+}
+
+// Execute executes a command, returning its response. Returns the context
+// error if its deadline passes first, after which the client should be
+// closed.
+func (c *Client) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setDeadline(ctx)
+
+	// Send the command, then a response packet as an end marker, since
+	// responses can be split into packets and the server answers in order
+	id, err := c.write(typeCommand, command)
+	if err != nil {
+		return "", c.contextError(ctx, err)
+	}
+	end, err := c.write(typeResponse, "")
+	if err != nil {
+		return "", c.contextError(ctx, err)
+	}
+
+	var response strings.Builder
+	for {
+
+		responseID, body, err := c.read()
+		if err != nil {
+			return response.String(), c.contextError(ctx, err)
+		}
+		switch responseID {
+		case id:
+			response.WriteString(body)
+		case end:
+			return response.String(), nil
+		}
+
+	}
+
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// setDeadline sets the connection deadline to the context deadline, if any.
+func (c *Client) setDeadline(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+}
+
+// contextError returns the context error if the context is done, which
+// caused err, otherwise err.
+func (c *Client) contextError(ctx context.Context, err error) error {
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// The connection deadline can pass just before the context is done
+	var netErr net.Error
+	deadline, ok := ctx.Deadline()
+	if ok && !time.Now().Before(deadline) &&
+		errors.As(err, &netErr) && netErr.Timeout() {
+		return context.DeadlineExceeded
+	}
+	return err
+
+}
+
+// write writes a packet, returning its request id.
+func (c *Client) write(packetType int32, body string) (int32, error) {
+
+	c.id++
+	id := c.id
+
+	// Length, request id, type, null-terminated body and an empty string
+	data := make([]byte, 12, 14+len(body))
+	binary.LittleEndian.PutUint32(data[0:], uint32(10+len(body)))
+	binary.LittleEndian.PutUint32(data[4:], uint32(id))
+	binary.LittleEndian.PutUint32(data[8:], uint32(packetType))
+	data = append(data, body...)
+	data = append(data, 0, 0)
+
+	_, err := c.conn.Write(data)
+	return id, err
+
+}
+
+// read reads a packet, returning its request id and body.
+func (c *Client) read() (int32, string, error) {
+
+	var length int32
+	err := binary.Read(c.reader, binary.LittleEndian, &length)
+	if err != nil {
+		return 0, "", err
+	}
+	if length < 10 || length > maxPacketLength {
+		return 0, "", fmt.Errorf("invalid rcon packet length %d", length)
+	}
+
+	// Request id, type and body
+	data := make([]byte, length)
+	_, err = io.ReadFull(c.reader, data)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id := int32(binary.LittleEndian.Uint32(data[0:]))
+	body := strings.TrimRight(string(data[8:]), "\x00")
+	return id, body, nil
+
+}
+
+// A Conn executes commands over RCON, connecting when needed and again after
+// errors. It is safe for concurrent use.
+type Conn struct {
+	addr     string
+	password string
+
+	mu     sync.Mutex
+	client *Client // nil if not connected
+}
+
+// NewConn returns a new Conn to an RCON server, not connected yet.
+func NewConn(addr string, password string) *Conn {
+	c := Conn{}
+	c.addr = addr
+	c.password = password
+	return &c
+}
+
+// Execute executes a command, connecting if not connected. Errors close the
+// connection.
+func (c *Conn) Execute(ctx context.Context, command string) (string, error) {
+
+	client, err := c.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := client.Execute(ctx, command)
+	if err != nil {
+		c.disconnect(client)
+	}
+	return output, err
+
+}
+
+// Close closes the connection if connected.
+func (c *Conn) Close() {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client != nil {
+		c.disconnect(client)
+	}
+}
+
+// connect returns the client, connecting if not connected.
+func (c *Conn) connect(ctx context.Context) (*Client, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	client, err := Dial(ctx, c.addr, c.password)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+
+}
+
+// disconnect closes a client, forgetting it if it is the current one.
+func (c *Conn) disconnect(client *Client) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == client {
+		c.client = nil
+	}
+	client.Close()
+
+}
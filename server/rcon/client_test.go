@@ -0,0 +1,337 @@
+package rcon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBodyLength is the longest response body of a packet of a fakeRcon, as
+// of Minecraft.
+const fakeBodyLength = 4096
+
+// A fakeRcon is a Minecraft RCON server. Commands are answered from
+// responses, split into packets as by Minecraft, and the stop command
+// closes the server unless it has a response.
+type fakeRcon struct {
+	listener  net.Listener
+	password  string
+	responses map[string]string
+
+	mu       sync.Mutex
+	commands []string
+	conns    []net.Conn
+}
+
+// newFakeRcon returns a new fakeRcon listening on a local address, closed
+// when the test ends.
+func newFakeRcon(t *testing.T, password string) *fakeRcon {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := fakeRcon{}
+	f.listener = listener
+	f.password = password
+	f.responses = map[string]string{
+		"list": "There are 0 of a max of 20 players online: ",
+		"long": strings.Repeat("a", 2*fakeBodyLength+100),
+	}
+	t.Cleanup(f.close)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+
+	return &f
+
+}
+
+// addr returns the address of the server.
+func (f *fakeRcon) addr() string {
+	return f.listener.Addr().String()
+}
+
+// close stops listening and closes all connections.
+func (f *fakeRcon) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listener.Close()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// executed returns the commands executed so far.
+func (f *fakeRcon) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// serve answers the packets of a connection until it closes.
+func (f *fakeRcon) serve(conn net.Conn) {
+
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+
+	for {
+
+		id, packetType, body, err := readFakePacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch {
+
+		// A failed login responds with id -1
+		case packetType == typeLogin:
+			authenticated = body == f.password
+			if !authenticated {
+				id = -1
+			}
+			writeFakePacket(conn, id, typeCommand, "")
+		case !authenticated:
+			return
+
+		// Unknown packet types are answered, as the end marker
+		case packetType != typeCommand:
+			writeFakePacket(conn, id, typeResponse, "Unknown request 0")
+
+		default:
+			f.mu.Lock()
+			f.commands = append(f.commands, body)
+			f.mu.Unlock()
+			response, ok := f.responses[body]
+			if !ok && body == "stop" {
+				f.close()
+				return
+			}
+			if !ok {
+				response = "Unknown command"
+			}
+			for {
+				n := len(response)
+				if n > fakeBodyLength {
+					n = fakeBodyLength
+				}
+				writeFakePacket(conn, id, typeResponse, response[:n])
+				response = response[n:]
+				if response == "" {
+					break
+				}
+			}
+
+		}
+
+	}
+
+}
+
+// readFakePacket reads a packet, returning its request id, type and body.
+func readFakePacket(r io.Reader) (int32, int32, string, error) {
+
+	var header struct{ Length, ID, Type int32 }
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if header.Length < 10 {
+		return 0, 0, "", errors.New("invalid length")
+	}
+	body := make([]byte, header.Length-8)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return header.ID, header.Type, strings.TrimRight(string(body), "\x00"), nil
+
+}
+
+// writeFakePacket writes a packet.
+func writeFakePacket(w io.Writer, id int32, packetType int32, body string) {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, int32(10+len(body)))
+	binary.Write(&buffer, binary.LittleEndian, id)
+	binary.Write(&buffer, binary.LittleEndian, packetType)
+	buffer.WriteString(body)
+	buffer.Write([]byte{0, 0})
+	w.Write(buffer.Bytes())
+}
+
+// testContext returns a context for a test request.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestPacketFraming(t *testing.T) {
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := Client{}
+	c.conn = client
+	c.reader = bufio.NewReader(client)
+
+	// Length, request id, type, body and two nulls, little endian
+	go c.write(typeCommand, "list")
+	got := make([]byte, 18)
+	_, err := io.ReadFull(server, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		14, 0, 0, 0,
+		1, 0, 0, 0,
+		2, 0, 0, 0,
+		'l', 'i', 's', 't', 0, 0,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got packet % x, want % x", got, want)
+	}
+
+	go server.Write([]byte{
+		12, 0, 0, 0,
+		7, 0, 0, 0,
+		0, 0, 0, 0,
+		'h', 'i', 0, 0,
+	})
+	id, body, err := c.read()
+	if err != nil || id != 7 || body != "hi" {
+		t.Errorf("read: got %d, %q, %v", id, body, err)
+	}
+
+	// Lengths outside a packet of Minecraft are rejected
+	for _, length := range [][]byte{{9, 0, 0, 0}, {11, 16, 0, 0}} {
+		go server.Write(length)
+		_, _, err = c.read()
+		if err == nil {
+			t.Errorf("read of length % x: got no error", length)
+		}
+	}
+
+}
+
+func TestDialAuth(t *testing.T) {
+
+	f := newFakeRcon(t, "secret")
+
+	_, err := Dial(testContext(t), f.addr(), "wrong")
+	if !errors.Is(err, ErrAuth) {
+		t.Errorf("wrong password: got %v, want ErrAuth", err)
+	}
+
+	c, err := Dial(testContext(t), f.addr(), "secret")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	c.Close()
+
+}
+
+func TestExecute(t *testing.T) {
+
+	f := newFakeRcon(t, "secret")
+	c, err := Dial(testContext(t), f.addr(), "secret")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer c.Close()
+
+	// Responses split into packets are joined until the end marker
+	for _, command := range []string{"list", "long", "list"} {
+		output, err := c.Execute(testContext(t), command)
+		if err != nil || output != f.responses[command] {
+			t.Errorf("%s: got %d bytes, %v, want %d bytes", command,
+				len(output), err, len(f.responses[command]))
+		}
+	}
+
+}
+
+func TestExecuteTimeout(t *testing.T) {
+
+	// A server that never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			id, _, _, _ := readFakePacket(reader)
+			writeFakePacket(conn, id, typeCommand, "")
+			io.Copy(io.Discard, reader)
+		}
+	}()
+
+	c, err := Dial(testContext(t), listener.Addr().String(), "secret")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		50*time.Millisecond,
+	)
+	defer cancel()
+	_, err = c.Execute(ctx, "list")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+
+}
+
+func TestConnReconnects(t *testing.T) {
+
+	f := newFakeRcon(t, "secret")
+	c := NewConn(f.addr(), "secret")
+	defer c.Close()
+
+	_, err := c.Execute(testContext(t), "list")
+	if err != nil {
+		t.Fatalf("execute: %s", err)
+	}
+
+	// A closed connection fails the command and is replaced
+	f.mu.Lock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+	_, err = c.Execute(testContext(t), "list")
+	if err == nil {
+		t.Error("execute on closed connection: got no error")
+	}
+	output, err := c.Execute(testContext(t), "list")
+	if err != nil || output != f.responses["list"] {
+		t.Errorf("execute after reconnect: got %q, %v", output, err)
+	}
+
+}
@@ -0,0 +1,346 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golem/protocol"
+	serverPkg "golem/server"
+)
+
+// An RconServer implements server.Server for a server run by other tooling,
+// executing commands over RCON. The state is polled from the reachability of
+// the server by status ping, or else of RCON, and the server is started and
+// stopped by optional shell commands.
+type RconServer struct {
+	states  *serverPkg.StateMachine
+	logger  *log.Logger
+	options Options
+
+	conn *Conn
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close to end polling
+
+	mu           sync.Mutex // guards state changes and times
+	startTime    time.Time
+	runningSince time.Time
+}
+
+// Options are the options of an RconServer.
+type Options struct {
+	// Addr and Password are the RCON address and password
+	Addr     string
+	Password string
+
+	// ServerAddr is pinged with ProtocolVersion every Interval
+	ServerAddr      string
+	ProtocolVersion int
+	Interval        time.Duration
+
+	// StartCommand and StopCommand are shell commands run in Directory,
+	// where an empty StartCommand disables starting and an empty
+	// StopCommand stops with the RCON stop command
+	StartCommand string
+	StopCommand  string
+	Directory    string
+
+	// StartTimeout fails starts taking longer, where zero disables it, and
+	// StopTimeout fails stops taking longer
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+}
+
+// NewRconServer returns a new RconServer, polling its state.
+func NewRconServer(logger *log.Logger, options Options) *RconServer {
+	s := RconServer{}
+	s.states = serverPkg.NewStateMachine(serverPkg.Stopped)
+	s.logger = logger
+	s.options = options
+	s.conn = NewConn(options.Addr, options.Password)
+	s.closed = make(chan struct{})
+	go s.poll()
+	return &s
+}
+
+// Start implements server.Server by running the start command. The server
+// is running once it is reachable.
+func (s *RconServer) Start() error {
+
+	if s.options.StartCommand == "" {
+		return fmt.Errorf("tried to start server without start command")
+	}
+
+	// State changes hold mu
+	s.mu.Lock()
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err == nil {
+		s.startTime = time.Now()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Fail the start if the command fails
+	go func() {
+		err := s.run(s.options.StartCommand)
+		if err == nil {
+			return
+		}
+		s.logger.Printf("error starting server: %s\n", err)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.states.State() == serverPkg.Starting {
+			reason := fmt.Sprintf("start failed: %s", err)
+			s.states.Set(serverPkg.Stopped, reason)
+		}
+	}()
+
+	return nil
+
+}
+
+// Stop implements server.Server by running the stop command, or the RCON
+// stop command, and waiting until the server is unreachable. Stopping a
+// stopping server waits for it to stop.
+func (s *RconServer) Stop() error {
+
+	err := func() error {
+
+		// State changes hold mu
+		s.mu.Lock()
+		state := s.states.State()
+		var err error
+		switch state {
+		case serverPkg.Stopped:
+			err = serverPkg.ErrStopped
+		case serverPkg.Starting, serverPkg.Running:
+			err = s.states.Transition(
+				state,
+				serverPkg.Stopping,
+				"stop requested",
+			)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		// Stop unless another stop does
+		if state != serverPkg.Stopping {
+			s.stop()
+		}
+
+		// Wait until the poll finds the server unreachable
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			s.options.StopTimeout,
+		)
+		defer cancel()
+		_, err = s.states.Wait(ctx, serverPkg.Stopped)
+		if err == nil {
+			return nil
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		reason := fmt.Sprintf(
+			"stop timed out after %s",
+			s.options.StopTimeout,
+		)
+		s.states.Transition(serverPkg.Stopping, serverPkg.Running, reason)
+		return errors.New(reason)
+
+	}()
+	if err != nil {
+		s.logger.Printf("error stopping server: %s\n", err)
+	}
+
+	return err
+
+}
+
+// stop runs the stop command, or the RCON stop command.
+func (s *RconServer) stop() {
+
+	if s.options.StopCommand != "" {
+		err := s.run(s.options.StopCommand)
+		if err != nil {
+			s.logger.Printf("error running stop command: %s\n", err)
+		}
+		return
+	}
+
+	// The server may close the connection before answering
+	s.logger.Println("sending stop command")
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		s.options.StopTimeout,
+	)
+	defer cancel()
+	_, err := s.conn.Execute(ctx, serverPkg.StopCommand)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.logger.Printf("error sending stop command: %s\n", err)
+	}
+
+}
+
+// Execute implements server.Server over RCON.
+func (s *RconServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	// Check for error case
+	if s.states.State() != serverPkg.Running {
+		return "", fmt.Errorf("tried to execute on server that is not running")
+	}
+
+	return s.conn.Execute(ctx, command)
+
+}
+
+// State implements server.Server.
+func (s *RconServer) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *RconServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements server.Uptimer, from when the server was found running.
+func (s *RconServer) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states.State() != serverPkg.Running {
+		return 0
+	}
+	return time.Since(s.runningSince)
+}
+
+// Close implements server.Closer by ending the polling and closing the RCON
+// connection.
+func (s *RconServer) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.conn.Close()
+	return nil
+}
+
+// poll updates the state from the reachability of the server every
+// interval, until closed.
+func (s *RconServer) poll() {
+
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.update(s.reachable())
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+	}
+
+}
+
+// reachable returns if the server answers a status ping, or else accepts
+// RCON connections.
+func (s *RconServer) reachable() bool {
+
+	_, err := protocol.QueryStatus(
+		s.options.ServerAddr,
+		s.options.ProtocolVersion,
+		s.options.Interval,
+	)
+	if err == nil {
+		return true
+	}
+
+	conn, err := net.DialTimeout("tcp", s.options.Addr, s.options.Interval)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+
+}
+
+// update updates the state from the reachability of the server.
+func (s *RconServer) update(reachable bool) {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.states.State()
+	switch {
+
+	// Found running, such as when started by other tooling
+	case reachable && state == serverPkg.Stopped:
+		s.states.Transition(state, serverPkg.Starting, "server reachable")
+		fallthrough
+	case reachable && state == serverPkg.Starting:
+		s.states.Transition(
+			serverPkg.Starting,
+			serverPkg.Running,
+			"server reachable",
+		)
+		s.runningSince = time.Now()
+
+	// Found stopped, unless still starting
+	case !reachable && state == serverPkg.Starting:
+		timeout := s.options.StartTimeout
+		if timeout > 0 && time.Since(s.startTime) > timeout {
+			s.states.Set(
+				serverPkg.Stopped,
+				fmt.Sprintf("start timed out after %s", timeout),
+			)
+		}
+	case !reachable && state != serverPkg.Stopped:
+		s.states.Set(serverPkg.Stopped, "server unreachable")
+
+	}
+
+	// Connect again once reachable
+	if !reachable {
+		s.conn.Close()
+	}
+
+}
+
+// run runs a shell command in the directory, logging its output.
+func (s *RconServer) run(command string) error {
+
+	s.logger.Printf("running command: %s\n", command)
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Dir = s.options.Directory
+
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			s.logger.Printf("[%s] %s\n", command, line)
+		}
+	}
+	return err
+
+}
@@ -0,0 +1,293 @@
+package rcon
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golem/protocol"
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// newTestServer returns a new RconServer polling unreachable addresses
+// often, changing its options, closed when the test ends.
+func newTestServer(t *testing.T, change func(options *Options)) *RconServer {
+	options := Options{
+		Addr:            "127.0.0.1:1", // refuses connections
+		Password:        "secret",
+		ServerAddr:      "127.0.0.1:1",
+		ProtocolVersion: 756,
+		Interval:        10 * time.Millisecond,
+		StopTimeout:     5 * time.Second,
+		Directory:       t.TempDir(),
+	}
+	change(&options)
+	s := NewRconServer(log.New(io.Discard, "", 0), options)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// listen listens on an address, answering status requests, until the
+// returned listener is closed.
+func listen(t *testing.T, addr string) net.Listener {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			c := protocol.NewClientConn(conn, nil)
+			c.ReadHandshakePacket()
+			c.ReadStatusRequestPacket()
+			c.WriteStatus(`{"description":"A Minecraft Server"}`)
+			c.Close()
+		}
+	}()
+
+	return listener
+
+}
+
+// exists returns if a file exists in a directory.
+func exists(directory string, name string) bool {
+	_, err := os.Stat(filepath.Join(directory, name))
+	return err == nil
+}
+
+func TestStateFromPing(t *testing.T) {
+
+	status := listen(t, "127.0.0.1:0")
+	s := newTestServer(t, func(options *Options) {
+		options.ServerAddr = status.Addr().String()
+	})
+
+	// Found running, such as when started by other tooling
+	servertest.Wait(t, s, serverPkg.Running)
+	if s.Uptime() <= 0 {
+		t.Error("running server has no uptime")
+	}
+
+	status.Close()
+	servertest.Wait(t, s, serverPkg.Stopped)
+	if s.Uptime() != 0 {
+		t.Error("stopped server has uptime")
+	}
+
+}
+
+func TestStateFromRcon(t *testing.T) {
+
+	f := newFakeRcon(t, "secret")
+	s := newTestServer(t, func(options *Options) {
+		options.Addr = f.addr()
+	})
+
+	servertest.Wait(t, s, serverPkg.Running)
+	output, err := s.Execute(testContext(t), "list")
+	if err != nil || output != f.responses["list"] {
+		t.Errorf("execute: got %q, %v", output, err)
+	}
+
+	f.close()
+	servertest.Wait(t, s, serverPkg.Stopped)
+	_, err = s.Execute(testContext(t), "list")
+	if err == nil {
+		t.Error("execute on stopped server: got no error")
+	}
+
+}
+
+func TestStartCommand(t *testing.T) {
+
+	// Reserve an address to listen on once started
+	reserved := listen(t, "127.0.0.1:0")
+	addr := reserved.Addr().String()
+	reserved.Close()
+
+	s := newTestServer(t, func(options *Options) {
+		options.ServerAddr = addr
+		options.StartCommand = "echo started > started"
+	})
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	err = s.Start()
+	if !errors.Is(err, serverPkg.ErrNotStopped) {
+		t.Errorf("second start: got %v, want ErrNotStopped", err)
+	}
+
+	// Starting until reachable
+	servertest.Eventually(
+		t,
+		func() bool { return exists(s.options.Directory, "started") },
+		"start command ran",
+	)
+	if state := s.State(); state != serverPkg.Starting {
+		t.Errorf("unreachable server is %s after start", state)
+	}
+	listen(t, addr)
+	servertest.Wait(t, s, serverPkg.Running)
+
+}
+
+func TestStartFails(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		change func(options *Options)
+	}{
+		{"without start command", func(options *Options) {}},
+		{"start command failed", func(options *Options) {
+			options.StartCommand = "exit 1"
+		}},
+		{"start timed out", func(options *Options) {
+			options.StartCommand = "exit 0"
+			options.StartTimeout = 50 * time.Millisecond
+		}},
+	}
+
+	for _, test := range tests {
+
+		s := newTestServer(t, test.change)
+		events, cancel := s.Subscribe()
+		err := s.Start()
+		if s.options.StartCommand == "" {
+			if err == nil {
+				t.Errorf("%s: got no error", test.name)
+			}
+			cancel()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: start: %s", test.name, err)
+		}
+
+		// Starting, then stopped again
+		servertest.Wait(t, s, serverPkg.Stopped)
+		cancel()
+		var got []serverPkg.ServerState
+		for event := range events {
+			got = append(got, event.New)
+		}
+		if len(got) != 2 || got[0] != serverPkg.Starting {
+			t.Errorf("%s: got states %v", test.name, got)
+		}
+
+	}
+
+}
+
+func TestStopCommand(t *testing.T) {
+
+	// The RCON stop command stops the server
+	f := newFakeRcon(t, "secret")
+	s := newTestServer(t, func(options *Options) {
+		options.Addr = f.addr()
+	})
+	servertest.Wait(t, s, serverPkg.Running)
+
+	err := s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if state := s.State(); state != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", state)
+	}
+	if commands := f.executed(); len(commands) != 1 ||
+		commands[0] != serverPkg.StopCommand {
+		t.Errorf("got commands %v", commands)
+	}
+	err = s.Stop()
+	if !errors.Is(err, serverPkg.ErrStopped) {
+		t.Errorf("second stop: got %v, want ErrStopped", err)
+	}
+
+}
+
+func TestStopShellCommand(t *testing.T) {
+
+	// The stop command stops the server instead of RCON
+	f := newFakeRcon(t, "secret")
+	s := newTestServer(t, func(options *Options) {
+		options.Addr = f.addr()
+		options.StopCommand = "echo stopped > stopped"
+	})
+	servertest.Wait(t, s, serverPkg.Running)
+	go func() {
+		deadline := time.Now().Add(servertest.WaitTimeout)
+		for !exists(s.options.Directory, "stopped") &&
+			time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		f.close()
+	}()
+
+	err := s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if state := s.State(); state != serverPkg.Stopped {
+		t.Errorf("state after stop is %s", state)
+	}
+	if commands := f.executed(); len(commands) != 0 {
+		t.Errorf("got rcon commands %v", commands)
+	}
+
+}
+
+func TestStopTimeout(t *testing.T) {
+
+	// A server that does not stop keeps running
+	f := newFakeRcon(t, "secret")
+	f.responses[serverPkg.StopCommand] = "Stopping the server"
+	s := newTestServer(t, func(options *Options) {
+		options.Addr = f.addr()
+		options.StopTimeout = 100 * time.Millisecond
+	})
+	servertest.Wait(t, s, serverPkg.Running)
+
+	err := s.Stop()
+	if err == nil {
+		t.Error("stop: got no error")
+	}
+	if state := s.State(); state != serverPkg.Running {
+		t.Errorf("state after stop timed out is %s", state)
+	}
+
+}
+
+func TestCloseEndsPolling(t *testing.T) {
+
+	f := newFakeRcon(t, "secret")
+	s := newTestServer(t, func(options *Options) {
+		options.Addr = f.addr()
+	})
+	servertest.Wait(t, s, serverPkg.Running)
+
+	// The state is no longer updated, once a poll in flight is done
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	time.Sleep(5 * s.options.Interval)
+	f.close()
+	time.Sleep(10 * s.options.Interval)
+	if state := s.State(); state != serverPkg.Running {
+		t.Errorf("closed server is %s", state)
+	}
+
+}
@@ -0,0 +1,232 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// handshakeTimeout is the time a client has to authenticate.
+const handshakeTimeout = 10 * time.Second
+
+// An Agent serves local server managers to RemoteServers by name, such as
+// process servers on a machine other than the proxy.
+type Agent struct {
+	logger  *log.Logger
+	token   string
+	servers map[string]serverPkg.Server // by server name
+}
+
+// NewAgent returns a new Agent serving servers to clients with a token.
+func NewAgent(
+	logger *log.Logger,
+	token string,
+	servers map[string]serverPkg.Server,
+) *Agent {
+	a := Agent{}
+	a.logger = logger
+	a.token = token
+	a.servers = servers
+	return &a
+}
+
+// ListenAndServe listens on a TCP address and serves clients.
+func (a *Agent) ListenAndServe(addr string) error {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	a.logger.Printf("listening on %s\n", listener.Addr())
+
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serve(newConn(c))
+	}
+
+}
+
+// serve serves a client until it disconnects.
+func (a *Agent) serve(c *conn) {
+
+	defer c.Close()
+	addr := c.RemoteAddr()
+
+	name, agentNonce, clientNonce, err := a.authenticate(c)
+	if err != nil {
+		a.logger.Printf("error authenticating %s: %s\n", addr, err)
+		c.write(message{Type: typeError, Error: err.Error()})
+		return
+	}
+	a.logger.Printf("client %s connected to server %s\n", addr, name)
+
+	// Prove the token to the client with the state, subscribing before to
+	// not miss changes
+	server := a.servers[name]
+	events, cancel := server.Subscribe()
+	defer cancel()
+	state := server.State().String()
+	err = c.write(message{
+		Type:  typeWelcome,
+		MAC:   mac(a.token, typeWelcome, clientNonce, state),
+		State: state,
+	})
+	if err != nil {
+		a.logger.Printf("error writing to %s: %s\n", addr, err)
+		return
+	}
+	c.authenticate(a.token, agentNonce, clientNonce, true)
+
+	// Requests are handled concurrently, and pending executes are canceled
+	// on disconnect
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+	results := make(chan message)
+	go a.write(ctx, c, events, results)
+
+	for {
+		request, err := c.read()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				a.logger.Printf("error reading from %s: %s\n", addr, err)
+			}
+			break
+		}
+		go func() {
+			result := a.handle(ctx, server, request)
+			select {
+			case results <- result:
+			case <-ctx.Done():
+			}
+		}()
+	}
+	a.logger.Printf("client %s disconnected\n", addr)
+
+}
+
+// authenticate challenges a client, returning the server name it asks for,
+// and the nonces of the agent and the client.
+func (a *Agent) authenticate(c *conn) (string, string, string, error) {
+
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.SetDeadline(time.Time{})
+
+	nonce, err := newNonce()
+	if err != nil {
+		return "", "", "", err
+	}
+	err = c.write(message{Type: typeChallenge, Nonce: nonce})
+	if err != nil {
+		return "", "", "", err
+	}
+
+	auth, err := c.read()
+	if err != nil {
+		return "", "", "", err
+	}
+	if auth.Type != typeAuth ||
+		!checkMAC(auth.MAC, a.token, typeAuth, nonce, auth.Server) {
+		return "", "", "", errAuth
+	}
+	if _, ok := a.servers[auth.Server]; !ok {
+		return "", "", "", errors.New("unknown server " + auth.Server)
+	}
+	return auth.Server, nonce, auth.Nonce, nil
+
+}
+
+// write writes state events and results to a client until ctx is done.
+// Events before a result are written first, so the client has the state of
+// the server when a request completes.
+func (a *Agent) write(
+	ctx context.Context,
+	c *conn,
+	events <-chan serverPkg.StateEvent,
+	results <-chan message,
+) {
+
+	event := func(e serverPkg.StateEvent) message {
+		return message{
+			Type:   typeState,
+			State:  e.New.String(),
+			Reason: e.Reason,
+		}
+	}
+
+	for {
+
+		var m message
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			m = event(e)
+		case result := <-results:
+			for pending := true; pending; {
+				select {
+				case e, ok := <-events:
+					pending = ok
+					if ok {
+						c.write(event(e))
+					}
+				default:
+					pending = false
+				}
+			}
+			m = result
+		case <-ctx.Done():
+			return
+		}
+
+		// Reading fails too and ends the connection
+		err := c.write(m)
+		if err != nil {
+			c.Close()
+			return
+		}
+
+	}
+
+}
+
+// handle handles a request, returning its result.
+func (a *Agent) handle(
+	ctx context.Context,
+	server serverPkg.Server,
+	request message,
+) message {
+
+	result := message{Type: typeResult, ID: request.ID}
+	var err error
+	switch request.Type {
+	case typeStart:
+		err = server.Start()
+	case typeStop:
+		err = server.Stop()
+	case typeExecute:
+		if request.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(
+				ctx,
+				time.Duration(request.Timeout)*time.Millisecond,
+			)
+			defer cancel()
+		}
+		result.Output, err = server.Execute(ctx, request.Command)
+	default:
+		err = errors.New("unknown request type " + request.Type)
+	}
+	result.Error = errorString(err)
+	return result
+
+}
@@ -0,0 +1,130 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// startAgent starts an agent with a token serving a fake server named
+// "survival", returning its address and the server.
+func startAgent(t *testing.T, token string) (string, *servertest.Server) {
+
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server := servertest.NewServer(serverPkg.Stopped)
+	agent := NewAgent(
+		log.New(io.Discard, "", 0),
+		token,
+		map[string]serverPkg.Server{"survival": server},
+	)
+	go agent.ListenAndServe(addr)
+	return addr, server
+
+}
+
+// newTestServer returns a RemoteServer of the server "survival" of an
+// agent, closed when the test ends.
+func newTestServer(t *testing.T, addr string, token string) *RemoteServer {
+	s := NewRemoteServer(
+		log.New(io.Discard, "", 0),
+		Options{
+			Addr:          addr,
+			Token:         token,
+			Server:        "survival",
+			RetryInterval: 10 * time.Millisecond,
+		},
+	)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// connected returns if a RemoteServer is connected.
+func connected(s *RemoteServer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil
+}
+
+func TestRemoteServer(t *testing.T) {
+
+	addr, server := startAgent(t, "token")
+	s := newTestServer(t, addr, "token")
+	servertest.Eventually(
+		t,
+		func() bool { return connected(s) },
+		"connected to agent",
+	)
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := s.Execute(ctx, "list")
+	if err != nil || output != "executed list" {
+		t.Errorf("execute: got %q, %v", output, err)
+	}
+	if commands := server.Commands(); len(commands) != 1 {
+		t.Errorf("agent server got commands %v", commands)
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	err = s.Stop()
+	if !errors.Is(err, serverPkg.ErrStopped) {
+		t.Errorf("second stop: got %v, want ErrStopped", err)
+	}
+
+}
+
+func TestRemoteServerBadToken(t *testing.T) {
+
+	addr, _ := startAgent(t, "token")
+	s := newTestServer(t, addr, "wrong")
+	time.Sleep(100 * time.Millisecond)
+	err := s.Start()
+	if !errors.Is(err, errDisconnected) {
+		t.Errorf("start with bad token: got %v, want errDisconnected", err)
+	}
+
+}
+
+func TestCloseDisconnects(t *testing.T) {
+
+	addr, server := startAgent(t, "token")
+	server.Start()
+	s := newTestServer(t, addr, "token")
+	servertest.Wait(t, s, serverPkg.Running)
+
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Stopped)
+
+	// No reconnecting after closing
+	time.Sleep(10 * s.options.RetryInterval)
+	if connected(s) || s.State() != serverPkg.Stopped {
+		t.Errorf("closed server is %s", s.State())
+	}
+
+}
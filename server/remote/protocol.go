@@ -0,0 +1,232 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	serverPkg "golem/server"
+)
+
+// The protocol between a RemoteServer and an Agent is JSON messages, one per
+// line, over TCP. The agent sends a challenge nonce, and the client answers
+// with the server name, the MAC of the nonce and the name with the shared
+// token, and its own nonce. The agent answers with the MAC of that nonce and
+// the server state, then sends state events and the results of requests by
+// id. After the welcome, every message in either direction carries a
+// sequence number and is prefixed with its MAC and a space, with a key of
+// that direction derived from the token and both nonces, so messages can not
+// be forged, replayed, reordered or dropped. Messages are not encrypted.
+
+// Message types
+const (
+	typeChallenge = "challenge"
+	typeAuth      = "auth"
+	typeWelcome   = "welcome"
+	typeError     = "error"
+	typeState     = "state"
+	typeStart     = "start"
+	typeStop      = "stop"
+	typeExecute   = "execute"
+	typeResult    = "result"
+)
+
+// maxMessageLength is the longest message line accepted, with room for long
+// command output.
+const maxMessageLength = 1 << 20
+
+// errAuth is returned when either side fails to authenticate.
+var errAuth = errors.New("agent authentication failed")
+
+// errMessageAuth is returned for messages with a bad sequence number or MAC.
+var errMessageAuth = errors.New("message authentication failed")
+
+// A message is a message of the protocol, where fields depend on the type.
+type message struct {
+	Type string `json:"type"`
+	ID   int    `json:"id,omitempty"` // of requests and results
+
+	// Authentication, and the sequence number after the welcome
+	Server string `json:"server,omitempty"`
+	Nonce  string `json:"nonce,omitempty"`
+	MAC    string `json:"mac,omitempty"`
+	Seq    uint64 `json:"seq,omitempty"`
+
+	// Welcome and state events
+	State  string `json:"state,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Execute requests, where Timeout is in milliseconds, and results
+	Command string `json:"command,omitempty"`
+	Timeout int64  `json:"timeout,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// A conn reads and writes messages, which are authenticated once the
+// session keys are set.
+type conn struct {
+	net.Conn
+	scanner *bufio.Scanner
+
+	writeKey string // of written messages, empty before the welcome
+	readKey  string // of read messages, empty before the welcome
+	writeSeq uint64
+	readSeq  uint64
+}
+
+// newConn returns a new conn of a network connection.
+func newConn(c net.Conn) *conn {
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(nil, maxMessageLength)
+	return &conn{Conn: c, scanner: scanner}
+}
+
+// authenticate sets the session keys of both directions from the token and
+// the nonces of the agent and the client, authenticating further messages.
+func (c *conn) authenticate(
+	token string,
+	agentNonce string,
+	clientNonce string,
+	agent bool,
+) {
+	agentKey := mac(token, "agent", agentNonce, clientNonce)
+	clientKey := mac(token, "client", agentNonce, clientNonce)
+	c.writeKey, c.readKey = clientKey, agentKey
+	if agent {
+		c.writeKey, c.readKey = agentKey, clientKey
+	}
+}
+
+// read reads a message, checking its MAC and sequence number if
+// authenticated.
+func (c *conn) read() (message, error) {
+
+	var m message
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		return m, err
+	}
+	data := c.scanner.Bytes()
+
+	// Authenticated messages are the MAC, a space and the message
+	if c.readKey != "" {
+		i := bytes.IndexByte(data, ' ')
+		if i < 0 {
+			return m, errMessageAuth
+		}
+		got := string(data[:i])
+		data = data[i+1:]
+		if !checkMAC(got, c.readKey, string(data)) {
+			return m, errMessageAuth
+		}
+	}
+
+	err := json.Unmarshal(data, &m)
+	if err != nil || c.readKey == "" {
+		return m, err
+	}
+	c.readSeq++
+	if m.Seq != c.readSeq {
+		return m, errMessageAuth
+	}
+	return m, nil
+
+}
+
+// write writes a message, with a sequence number and MAC if authenticated.
+// Not safe for concurrent use.
+func (c *conn) write(m message) error {
+
+	if c.writeKey != "" {
+		c.writeSeq++
+		m.Seq = c.writeSeq
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if c.writeKey != "" {
+		data = append([]byte(mac(c.writeKey, string(data))+" "), data...)
+	}
+	_, err = c.Write(append(data, '\n'))
+	return err
+
+}
+
+// newNonce returns a random nonce.
+func newNonce() (string, error) {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// mac returns the MAC of some parts with a token, where each side uses a
+// different first part so MACs can not be reflected.
+func mac(token string, parts ...string) string {
+	h := hmac.New(sha256.New, []byte(token))
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkMAC returns if a MAC of some parts with a token is valid.
+func checkMAC(got string, token string, parts ...string) bool {
+	return hmac.Equal([]byte(got), []byte(mac(token, parts...)))
+}
+
+// states are the server states by name.
+var states = map[string]serverPkg.ServerState{
+	serverPkg.Stopped.String():  serverPkg.Stopped,
+	serverPkg.Starting.String(): serverPkg.Starting,
+	serverPkg.Running.String():  serverPkg.Running,
+	serverPkg.Stopping.String(): serverPkg.Stopping,
+	serverPkg.Paused.String():   serverPkg.Paused,
+}
+
+// parseState returns the server state of a name.
+func parseState(name string) (serverPkg.ServerState, error) {
+	state, ok := states[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown server state %q", name)
+	}
+	return state, nil
+}
+
+// errorString returns the message of an error, or empty if nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// parseError returns the error of a message, keeping the errors of the
+// server package so they can be checked.
+func parseError(message string) error {
+	switch message {
+	case "":
+		return nil
+	case serverPkg.ErrNotStopped.Error():
+		return serverPkg.ErrNotStopped
+	case serverPkg.ErrStopped.Error():
+		return serverPkg.ErrStopped
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newPipe returns the ends of an authenticated connection between an agent
+// and a client, and the network end of the client to write raw lines.
+func newPipe() (*conn, *conn, net.Conn) {
+	agentEnd, clientEnd := net.Pipe()
+	agent := newConn(agentEnd)
+	client := newConn(clientEnd)
+	agent.authenticate("token", "agent nonce", "client nonce", true)
+	client.authenticate("token", "agent nonce", "client nonce", false)
+	return agent, client, clientEnd
+}
+
+// readLine reads a raw line of a connection.
+func readLine(c net.Conn) (string, error) {
+	return bufio.NewReader(c).ReadString('\n')
+}
+
+func TestAuthenticatedMessages(t *testing.T) {
+
+	agent, client, _ := newPipe()
+
+	// Both directions
+	for i := 0; i < 3; i++ {
+		go client.write(message{Type: typeExecute, ID: i, Command: "list"})
+		m, err := agent.read()
+		if err != nil || m.ID != i || m.Command != "list" {
+			t.Fatalf("agent read: got %+v, %v", m, err)
+		}
+		go agent.write(message{Type: typeResult, ID: i, Output: "\xff"})
+		m, err = client.read()
+		if err != nil || m.ID != i {
+			t.Fatalf("client read: got %+v, %v", m, err)
+		}
+	}
+
+}
+
+func TestForgedMessages(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		forge  func(line string) string
+		reject bool
+	}{
+		{"unchanged", func(line string) string { return line }, false},
+		{"unauthenticated", func(line string) string {
+			return `{"type":"execute","seq":1,"command":"op mallory"}` + "\n"
+		}, true},
+		{"tampered", func(line string) string {
+			return strings.Replace(line, "list", "stop", 1)
+		}, true},
+		{"replayed", func(line string) string { return line + line }, true},
+	}
+
+	for _, test := range tests {
+
+		agent, client, clientEnd := newPipe()
+
+		// Capture the line the client writes, then write the forgery
+		agentEnd := agent.Conn
+		lines := make(chan string, 1)
+		go func() {
+			line, _ := readLine(agentEnd)
+			lines <- line
+		}()
+		client.write(message{Type: typeExecute, ID: 1, Command: "list"})
+		forged := test.forge(<-lines)
+
+		go clientEnd.Write([]byte(forged))
+		_, err := agent.read()
+		if test.name == "replayed" && err == nil {
+			_, err = agent.read()
+		}
+		if errors.Is(err, errMessageAuth) != test.reject {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+
+	}
+
+}
+
+func TestReflectedMessages(t *testing.T) {
+
+	// Messages of the agent are not accepted from the client
+	agent, client, _ := newPipe()
+	go agent.write(message{Type: typeState, State: "running"})
+	line, err := readLine(client.Conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Conn.Write([]byte(line))
+	_, err = agent.read()
+	if !errors.Is(err, errMessageAuth) {
+		t.Errorf("reflected message: got %v, want errMessageAuth", err)
+	}
+
+}
@@ -0,0 +1,317 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// errDisconnected is returned by requests while not connected to the agent.
+var errDisconnected = errors.New("not connected to agent")
+
+// A RemoteServer implements server.Server for a server of an Agent, such as a
+// process server on another machine. It stays connected to the agent,
+// reconnecting after errors, and follows the state of the server, which is
+// stopped while disconnected.
+type RemoteServer struct {
+	states  *serverPkg.StateMachine
+	logger  *log.Logger
+	options Options
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close to stop reconnecting
+
+	mu      sync.Mutex // guards fields below
+	conn    *conn      // nil if not connected
+	id      int
+	pending map[int]chan message // by request id
+}
+
+// Options are the options of a RemoteServer.
+type Options struct {
+	// Addr is the address of the agent, Token the shared token and Server
+	// the server name on the agent
+	Addr   string
+	Token  string
+	Server string
+
+	// RetryInterval is the wait before reconnecting
+	RetryInterval time.Duration
+}
+
+// NewRemoteServer returns a new RemoteServer, connecting to the agent.
+func NewRemoteServer(logger *log.Logger, options Options) *RemoteServer {
+	s := RemoteServer{}
+	s.states = serverPkg.NewStateMachine(serverPkg.Stopped)
+	s.logger = logger
+	s.options = options
+	s.pending = make(map[int]chan message)
+	s.closed = make(chan struct{})
+	go s.run()
+	return &s
+}
+
+// Start implements server.Server by starting the server on the agent.
+func (s *RemoteServer) Start() error {
+	_, err := s.request(context.Background(), message{Type: typeStart})
+	return err
+}
+
+// Stop implements server.Server by stopping the server on the agent, waiting
+// until it is stopped.
+func (s *RemoteServer) Stop() error {
+	_, err := s.request(context.Background(), message{Type: typeStop})
+	if err != nil {
+		s.logger.Printf("error stopping server: %s\n", err)
+	}
+	return err
+}
+
+// Execute implements server.Server by executing on the agent, which is given
+// the deadline of the context.
+func (s *RemoteServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	request := message{Type: typeExecute, Command: command}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Timeout = time.Until(deadline).Milliseconds()
+		if request.Timeout <= 0 {
+			return "", context.DeadlineExceeded
+		}
+	}
+
+	result, err := s.request(ctx, request)
+	return result.Output, err
+
+}
+
+// State implements server.Server.
+func (s *RemoteServer) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *RemoteServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// request sends a request to the agent and waits for its result, returning
+// the error of the result.
+func (s *RemoteServer) request(
+	ctx context.Context,
+	request message,
+) (message, error) {
+
+	result := make(chan message, 1)
+	err := func() error {
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.conn == nil {
+			return errDisconnected
+		}
+		s.id++
+		request.ID = s.id
+		s.pending[request.ID] = result
+		return s.conn.write(request)
+
+	}()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, request.ID)
+		s.mu.Unlock()
+	}()
+	if err != nil {
+		return message{}, err
+	}
+
+	select {
+	case m, ok := <-result:
+		if !ok {
+			return message{}, errDisconnected
+		}
+		return m, parseError(m.Error)
+	case <-ctx.Done():
+		return message{}, ctx.Err()
+	}
+
+}
+
+// Close implements server.Closer by disconnecting from the agent, without
+// reconnecting.
+func (s *RemoteServer) Close() error {
+
+	s.closeOnce.Do(func() { close(s.closed) })
+
+	s.mu.Lock()
+	c := s.conn
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+	}
+	return nil
+
+}
+
+// run connects to the agent and follows the state of the server, logging
+// connection errors once until they change, until closed.
+func (s *RemoteServer) run() {
+
+	var lastError string
+	for {
+
+		err := s.connect()
+		if err != nil && err.Error() != lastError {
+			s.logger.Printf("error connecting to agent: %s\n", err)
+		}
+		lastError = errorString(err)
+
+		select {
+		case <-time.After(s.options.RetryInterval):
+		case <-s.closed:
+			return
+		}
+
+	}
+
+}
+
+// connect connects to the agent and follows the state of the server until
+// the connection fails. Returns an error if connecting fails.
+func (s *RemoteServer) connect() error {
+
+	netConn, err := net.DialTimeout(
+		"tcp",
+		s.options.Addr,
+		handshakeTimeout,
+	)
+	if err != nil {
+		return err
+	}
+	c := newConn(netConn)
+	defer c.Close()
+
+	state, err := s.authenticate(c)
+	if err != nil {
+		return err
+	}
+
+	// Unless closed meanwhile, Close closes the connection
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.conn = c
+	s.mu.Unlock()
+
+	s.logger.Printf("connected to agent %s\n", s.options.Addr)
+	s.states.Follow(state, "agent connected")
+
+	// Fail pending requests when disconnected
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.conn = nil
+		for id, result := range s.pending {
+			close(result)
+			delete(s.pending, id)
+		}
+	}()
+	defer s.states.Follow(serverPkg.Stopped, "agent disconnected")
+
+	for {
+
+		m, err := c.read()
+		if err != nil {
+			s.logger.Printf("disconnected from agent: %s\n", err)
+			return nil
+		}
+
+		switch m.Type {
+		case typeState:
+			state, err := parseState(m.State)
+			if err != nil {
+				s.logger.Printf("error reading from agent: %s\n", err)
+				return nil
+			}
+			s.states.Follow(state, m.Reason)
+		case typeResult:
+			s.mu.Lock()
+			result, ok := s.pending[m.ID]
+			delete(s.pending, m.ID)
+			s.mu.Unlock()
+			if ok {
+				result <- m
+			}
+		}
+
+	}
+
+}
+
+// authenticate answers the challenge of the agent and checks its proof,
+// returning the state of the server, and authenticates further messages.
+func (s *RemoteServer) authenticate(c *conn) (serverPkg.ServerState, error) {
+
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.SetDeadline(time.Time{})
+
+	challenge, err := c.read()
+	if err != nil {
+		return 0, err
+	}
+	if challenge.Type != typeChallenge {
+		return 0, fmt.Errorf("unexpected message %q", challenge.Type)
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return 0, err
+	}
+	err = c.write(message{
+		Type:   typeAuth,
+		Server: s.options.Server,
+		Nonce:  nonce,
+		MAC: mac(
+			s.options.Token,
+			typeAuth,
+			challenge.Nonce,
+			s.options.Server,
+		),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	welcome, err := c.read()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case welcome.Type == typeError:
+		return 0, fmt.Errorf("agent: %s", welcome.Error)
+	case welcome.Type != typeWelcome || !checkMAC(
+		welcome.MAC,
+		s.options.Token,
+		typeWelcome,
+		nonce,
+		welcome.State,
+	):
+		return 0, errAuth
+	}
+	c.authenticate(s.options.Token, challenge.Nonce, nonce, false)
+	return parseState(welcome.State)
+
+}
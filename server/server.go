@@ -1,5 +1,10 @@
 package server
 
+import (
+	"context"
+	"time"
+)
+
 type ServerState int
 
 // Server state values
@@ -8,15 +13,102 @@ const (
 	Starting
 	Running
 	Stopping
+	Paused
 )
 
-// StopCommand is the Minecraft server stop command.
-const StopCommand = "stop"
+// Minecraft server commands
+const (
+	StopCommand = "stop"
+	SaveCommand = "save-all"
+)
 
 // Server is the interface that defines a server manager.
 type Server interface {
 	Start() error
 	Stop() error
-	Execute(command string) (string, error)
 	State() ServerState
+
+	// Execute executes a console command, returning its output lines
+	// joined by newlines. Returns the context error if it is done first.
+	Execute(ctx context.Context, command string) (string, error)
+
+	// Subscribe returns a channel of state changes and a function to cancel
+	// the subscription, which closes the channel. Events are dropped while
+	// the channel is full.
+	Subscribe() (<-chan StateEvent, func())
+}
+
+// A StateEvent is a change of the server state.
+type StateEvent struct {
+	Old    ServerState
+	New    ServerState
+	Reason string // such as "process exited"
+}
+
+// An Uptimer is a Server that reports how long it has been running.
+type Uptimer interface {
+	// Uptime returns the time since the server is running, or zero if it is
+	// not running.
+	Uptime() time.Duration
+}
+
+// A Pauser is a Server that can be paused instead of stopped, keeping it in
+// memory without using the CPU.
+type Pauser interface {
+	// Pause pauses a running server after saving the world.
+	Pause() error
+
+	// Resume resumes a paused server.
+	Resume() error
+}
+
+// A Detacher is a Server whose process can keep running when golem exits.
+type Detacher interface {
+	// Detached returns if the server process keeps running when golem
+	// exits, to be adopted by the next golem.
+	Detached() bool
+}
+
+// An IdleStopper is a Server that stops differently after the idle timeout,
+// such as by also suspending its host.
+type IdleStopper interface {
+	// StopIdle stops the server because nobody played on it.
+	StopIdle() error
+}
+
+// A Closer is a Server with background work, such as polling its state,
+// that ends when the server is closed, such as when it is removed from the
+// config. Closing does not stop the server, which is not used after.
+type Closer interface {
+	// Close ends the background work of the server.
+	Close() error
+}
+
+// A StartupProgress is the progress of a server start.
+type StartupProgress struct {
+	Elapsed   time.Duration
+	Percent   int           // -1 if unknown
+	Remaining time.Duration // -1 if unknown
+}
+
+// A StartupReporter is a Server that reports the progress of a start.
+type StartupReporter interface {
+	// StartupProgress returns the progress of the current start, or false
+	// if the server is not starting.
+	StartupProgress() (StartupProgress, bool)
+}
+
+// A Crash is an exit of a running or paused server that was not requested.
+type Crash struct {
+	Time   time.Time
+	Reason string // crash report description or exit status
+	Report string // crash report file, if any
+	GaveUp bool   // restarts gave up after too many crashes
+}
+
+// A CrashReporter is a Server that reports crashes.
+type CrashReporter interface {
+	// LastCrash returns the last crash since the server was running, or
+	// false if there is none.
+	LastCrash() (Crash, bool)
 }
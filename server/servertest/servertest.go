@@ -0,0 +1,192 @@
+// Package servertest provides a fake server manager and helpers for tests of
+// server managers and their users.
+package servertest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// WaitTimeout is the longest Wait waits for a state.
+const WaitTimeout = 10 * time.Second
+
+// A Server is a fake server.Server that starts and stops at once. Commands
+// are recorded and answered with "executed <command>".
+type Server struct {
+	states *serverPkg.StateMachine
+
+	mu       sync.Mutex
+	commands []string
+	stops    int
+	closed   bool
+}
+
+// NewServer returns a new Server in a state.
+func NewServer(state serverPkg.ServerState) *Server {
+	s := Server{}
+	s.states = serverPkg.NewStateMachine(state)
+	return &s
+}
+
+// Start implements server.Server.
+func (s *Server) Start() error {
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err != nil {
+		return err
+	}
+	return s.states.Transition(
+		serverPkg.Starting,
+		serverPkg.Running,
+		"startup done",
+	)
+}
+
+// Stop implements server.Server.
+func (s *Server) Stop() error {
+
+	s.mu.Lock()
+	s.stops++
+	s.mu.Unlock()
+
+	if s.states.State() == serverPkg.Stopped {
+		return serverPkg.ErrStopped
+	}
+	_, err := s.states.Set(serverPkg.Stopped, "stopped")
+	return err
+
+}
+
+// Execute implements server.Server.
+func (s *Server) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+
+	if s.states.State() != serverPkg.Running {
+		return "", errors.New("server is not running")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, command)
+	return "executed " + command, nil
+
+}
+
+// State implements server.Server.
+func (s *Server) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *Server) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Close implements server.Closer.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// Follow changes the state as if changed by other tooling.
+func (s *Server) Follow(state serverPkg.ServerState) {
+	s.states.Follow(state, "changed by test")
+}
+
+// Commands returns the executed commands.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Stops returns the number of stops, including failed ones.
+func (s *Server) Stops() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stops
+}
+
+// Closed returns if the server was closed.
+func (s *Server) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// A PausingServer is a Server that implements server.Pauser.
+type PausingServer struct {
+	*Server
+}
+
+// NewPausingServer returns a new PausingServer in a state.
+func NewPausingServer(state serverPkg.ServerState) *PausingServer {
+	return &PausingServer{NewServer(state)}
+}
+
+// Pause implements server.Pauser.
+func (s *PausingServer) Pause() error {
+	return s.states.Transition(serverPkg.Running, serverPkg.Paused, "paused")
+}
+
+// Resume implements server.Pauser.
+func (s *PausingServer) Resume() error {
+	return s.states.Transition(serverPkg.Paused, serverPkg.Running, "resumed")
+}
+
+// Wait waits until a server is in a state for at most WaitTimeout, failing
+// the test otherwise.
+func Wait(t testing.TB, s serverPkg.Server, state serverPkg.ServerState) {
+
+	t.Helper()
+
+	// Passing states count, and the state is checked again periodically
+	// since events can be dropped
+	events, cancel := s.Subscribe()
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.NewTimer(WaitTimeout)
+	defer timeout.Stop()
+
+	for s.State() != state {
+		select {
+		case event := <-events:
+			if event.New == state {
+				return
+			}
+		case <-ticker.C:
+		case <-timeout.C:
+			t.Fatalf("waiting for %s: state is %s", state, s.State())
+		}
+	}
+
+}
+
+// Eventually waits until a condition is true for at most WaitTimeout,
+// failing the test with a message otherwise.
+func Eventually(t testing.TB, condition func() bool, message string) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(WaitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting: %s", message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+}
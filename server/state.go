@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Errors of starting or stopping a server in the wrong state
+var (
+	// ErrNotStopped is returned by Start when the server is not stopped,
+	// such as when another start is in flight
+	ErrNotStopped = errors.New("server is not stopped")
+
+	// ErrStopped is returned by Stop when the server is stopped
+	ErrStopped = errors.New("server is stopped")
+)
+
+// transitions are the allowed state changes, by state.
+var transitions = map[ServerState][]ServerState{
+	Stopped:  {Starting},
+	Starting: {Running, Stopping, Stopped},
+	Running:  {Stopping, Stopped, Paused},
+	Stopping: {Stopped, Running},
+	Paused:   {Running, Stopping, Stopped},
+}
+
+// followPaths are the states through which a stopped server reaches a state.
+var followPaths = map[ServerState][]ServerState{
+	Stopped:  {},
+	Starting: {Starting},
+	Running:  {Starting, Running},
+	Stopping: {Starting, Stopping},
+	Paused:   {Starting, Running, Paused},
+}
+
+// String returns the name of a state.
+func (s ServerState) String() string {
+	switch s {
+	case Stopped:
+		return "stopped"
+	case Starting:
+		return "starting"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	case Paused:
+		return "paused"
+	}
+	return fmt.Sprintf("ServerState(%d)", int(s))
+}
+
+// subscriptionBuffer is the number of state events buffered for a
+// subscriber, more are dropped.
+const subscriptionBuffer = 16
+
+// A StateMachine holds the state of a server for its manager, allowing only
+// the transitions Stopped → Starting → Running → Stopping → Stopped, where
+// starting servers can also stop, running servers can pause and resume,
+// stops can fail back to Running, and any server can exit to Stopped.
+// It is safe for concurrent use, and state changes can be waited for or
+// subscribed to.
+type StateMachine struct {
+	mu          sync.Mutex
+	state       ServerState
+	changed     chan struct{} // closed and replaced on change
+	subscribers map[chan StateEvent]bool
+}
+
+// NewStateMachine returns a new StateMachine in a state.
+func NewStateMachine(state ServerState) *StateMachine {
+	m := StateMachine{}
+	m.state = state
+	m.changed = make(chan struct{})
+	m.subscribers = make(map[chan StateEvent]bool)
+	return &m
+}
+
+// State returns the current state.
+func (m *StateMachine) State() ServerState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Transition changes the state from one state to another for a reason.
+// Returns an error if the state is not from, or the transition is not
+// allowed.
+func (m *StateMachine) Transition(
+	from ServerState,
+	to ServerState,
+	reason string,
+) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state != from {
+		if from == Stopped {
+			return ErrNotStopped
+		}
+		return fmt.Errorf("expected server %s but it is %s", from, m.state)
+	}
+
+	return m.set(to, reason)
+
+}
+
+// Set changes the state from the current state to another for a reason.
+// Returns the previous state, and an error if the transition is not allowed.
+func (m *StateMachine) Set(to ServerState, reason string) (ServerState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from := m.state
+	return from, m.set(to, reason)
+}
+
+// Follow changes the state to the state of another server, such as a remote
+// or wrapped server. Changes that were missed are caught up on through
+// Stopped.
+func (m *StateMachine) Follow(to ServerState, reason string) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state == to || m.set(to, reason) == nil {
+		return
+	}
+
+	if m.state != Stopped {
+		m.set(Stopped, reason)
+	}
+	for _, next := range followPaths[to] {
+		m.set(next, reason)
+	}
+
+}
+
+// set changes the state if allowed. Must hold mu.
+func (m *StateMachine) set(to ServerState, reason string) error {
+
+	allowed := false
+	for _, state := range transitions[m.state] {
+		allowed = allowed || state == to
+	}
+	if !allowed {
+		return fmt.Errorf("server can not go from %s to %s", m.state, to)
+	}
+
+	// Wake up waiters and notify subscribers
+	event := StateEvent{Old: m.state, New: to, Reason: reason}
+	m.state = to
+	close(m.changed)
+	m.changed = make(chan struct{})
+	for events := range m.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+	return nil
+
+}
+
+// Subscribe returns a channel of state changes and a function to cancel the
+// subscription, for managers implementing Server.Subscribe.
+func (m *StateMachine) Subscribe() (<-chan StateEvent, func()) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make(chan StateEvent, subscriptionBuffer)
+	m.subscribers[events] = true
+
+	// Cancel at most once
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			delete(m.subscribers, events)
+			close(events)
+		})
+	}
+
+	return events, cancel
+
+}
+
+// Changed returns the current state and a channel closed on the next state
+// change.
+func (m *StateMachine) Changed() (ServerState, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, m.changed
+}
+
+// Wait waits until the state is one of some states, returning it, or
+// returns the context error.
+func (m *StateMachine) Wait(
+	ctx context.Context,
+	states ...ServerState,
+) (ServerState, error) {
+
+	for {
+
+		state, changed := m.Changed()
+		for _, s := range states {
+			if state == s {
+				return state, nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return state, ctx.Err()
+		}
+
+	}
+
+}
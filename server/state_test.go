@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// allStates are all server states.
+var allStates = []ServerState{Stopped, Starting, Running, Stopping, Paused}
+
+func TestTransition(t *testing.T) {
+
+	allowed := map[[2]ServerState]bool{
+		{Stopped, Starting}:  true,
+		{Starting, Running}:  true,
+		{Starting, Stopping}: true,
+		{Starting, Stopped}:  true,
+		{Running, Stopping}:  true,
+		{Running, Stopped}:   true,
+		{Running, Paused}:    true,
+		{Stopping, Stopped}:  true,
+		{Stopping, Running}:  true,
+		{Paused, Running}:    true,
+		{Paused, Stopping}:   true,
+		{Paused, Stopped}:    true,
+	}
+
+	for _, from := range allStates {
+		for _, to := range allStates {
+			m := NewStateMachine(from)
+			err := m.Transition(from, to, "test")
+			if allowed[[2]ServerState{from, to}] != (err == nil) {
+				t.Errorf("%s to %s: unexpected error %v", from, to, err)
+			}
+			want := from
+			if err == nil {
+				want = to
+			}
+			if m.State() != want {
+				t.Errorf("%s to %s: state is %s", from, to, m.State())
+			}
+		}
+	}
+
+}
+
+func TestTransitionWrongState(t *testing.T) {
+
+	m := NewStateMachine(Running)
+
+	err := m.Transition(Stopped, Starting, "start")
+	if !errors.Is(err, ErrNotStopped) {
+		t.Errorf("start of running server: got %v, want ErrNotStopped", err)
+	}
+	err = m.Transition(Starting, Running, "ready")
+	if err == nil {
+		t.Error("transition from wrong state: got no error")
+	}
+	if m.State() != Running {
+		t.Errorf("state changed to %s", m.State())
+	}
+
+}
+
+func TestSet(t *testing.T) {
+
+	m := NewStateMachine(Running)
+
+	from, err := m.Set(Paused, "pause")
+	if err != nil || from != Running {
+		t.Errorf("set paused: got %s, %v", from, err)
+	}
+	from, err = m.Set(Starting, "start")
+	if err == nil {
+		t.Errorf("set starting from %s: got no error", from)
+	}
+	if m.State() != Paused {
+		t.Errorf("state is %s, want paused", m.State())
+	}
+
+}
+
+func TestFollow(t *testing.T) {
+
+	tests := []struct {
+		from   ServerState
+		to     ServerState
+		events []ServerState // new states
+	}{
+		{Stopped, Stopped, nil},
+		{Stopped, Running, []ServerState{Starting, Running}},
+		{Stopped, Paused, []ServerState{Starting, Running, Paused}},
+		{Starting, Running, []ServerState{Running}},
+		{Running, Stopped, []ServerState{Stopped}},
+		{Running, Starting, []ServerState{Stopped, Starting}},
+		{Stopping, Starting, []ServerState{Stopped, Starting}},
+		{Paused, Starting, []ServerState{Stopped, Starting}},
+		{Stopping, Paused, []ServerState{
+			Stopped, Starting, Running, Paused,
+		}},
+	}
+
+	for _, test := range tests {
+
+		m := NewStateMachine(test.from)
+		events, cancel := m.Subscribe()
+		m.Follow(test.to, "follow")
+		cancel()
+
+		var got []ServerState
+		old := test.from
+		for event := range events {
+			if event.Old != old || event.Reason != "follow" {
+				t.Errorf("%s to %s: unexpected event %+v", test.from,
+					test.to, event)
+			}
+			old = event.New
+			got = append(got, event.New)
+		}
+
+		if m.State() != test.to {
+			t.Errorf("%s to %s: state is %s", test.from, test.to, m.State())
+		}
+		if !equalStates(got, test.events) {
+			t.Errorf("%s to %s: got events %v, want %v", test.from, test.to,
+				got, test.events)
+		}
+
+	}
+
+}
+
+func TestSubscribe(t *testing.T) {
+
+	m := NewStateMachine(Stopped)
+	first, cancelFirst := m.Subscribe()
+	second, cancelSecond := m.Subscribe()
+
+	m.Transition(Stopped, Starting, "start requested")
+	m.Transition(Starting, Running, "startup done")
+
+	// Canceled subscriptions get no more events
+	cancelFirst()
+	cancelFirst()
+	m.Transition(Running, Stopping, "stop requested")
+	cancelSecond()
+
+	want := []StateEvent{
+		{Stopped, Starting, "start requested"},
+		{Starting, Running, "startup done"},
+		{Running, Stopping, "stop requested"},
+	}
+	if got := collect(first); !equalEvents(got, want[:2]) {
+		t.Errorf("first subscriber: got %v, want %v", got, want[:2])
+	}
+	if got := collect(second); !equalEvents(got, want) {
+		t.Errorf("second subscriber: got %v, want %v", got, want)
+	}
+
+}
+
+func TestSubscribeDropsWhenFull(t *testing.T) {
+
+	m := NewStateMachine(Running)
+	events, cancel := m.Subscribe()
+
+	for i := 0; i < subscriptionBuffer+4; i++ {
+		m.Transition(Running, Paused, "paused")
+		m.Transition(Paused, Running, "resumed")
+	}
+	cancel()
+
+	if got := len(collect(events)); got != subscriptionBuffer {
+		t.Errorf("got %d events, want %d", got, subscriptionBuffer)
+	}
+
+}
+
+func TestWait(t *testing.T) {
+
+	m := NewStateMachine(Stopped)
+
+	// Waiting for the current state returns at once
+	state, err := m.Wait(context.Background(), Stopped, Running)
+	if err != nil || state != Stopped {
+		t.Errorf("wait for current state: got %s, %v", state, err)
+	}
+
+	go func() {
+		m.Transition(Stopped, Starting, "start requested")
+		m.Transition(Starting, Running, "startup done")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	state, err = m.Wait(ctx, Running)
+	if err != nil || state != Running {
+		t.Errorf("wait for running: got %s, %v", state, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	state, err = m.Wait(ctx, Stopped)
+	if !errors.Is(err, context.DeadlineExceeded) || state != Running {
+		t.Errorf("wait for stopped: got %s, %v", state, err)
+	}
+
+}
+
+func TestConcurrentTransitions(t *testing.T) {
+
+	m := NewStateMachine(Stopped)
+	events, cancel := m.Subscribe()
+
+	// Only one of concurrent starts wins
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	started := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.Transition(Stopped, Starting, "start requested")
+			if err == nil {
+				mu.Lock()
+				started++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrNotStopped) {
+				t.Errorf("start: unexpected error %v", err)
+			}
+			m.State()
+		}()
+	}
+	wg.Wait()
+	if started != 1 {
+		t.Errorf("%d starts won, want 1", started)
+	}
+
+	// Waiters and followers see a consistent state
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(
+				context.Background(),
+				time.Second,
+			)
+			defer cancel()
+			_, err := m.Wait(ctx, Running, Stopped)
+			if err != nil {
+				t.Errorf("wait: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			m.Follow(Running, "follow")
+		}()
+	}
+	wg.Wait()
+	cancel()
+
+	got := collect(events)
+	want := []StateEvent{
+		{Stopped, Starting, "start requested"},
+		{Starting, Running, "follow"},
+	}
+	if !equalEvents(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+
+}
+
+// collect returns the events of a canceled subscription.
+func collect(events <-chan StateEvent) []StateEvent {
+	var got []StateEvent
+	for event := range events {
+		got = append(got, event)
+	}
+	return got
+}
+
+// equalStates returns if two lists of states are equal.
+func equalStates(a []ServerState, b []ServerState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalEvents returns if two lists of events are equal.
+func equalEvents(a []StateEvent, b []StateEvent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
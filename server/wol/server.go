@@ -0,0 +1,368 @@
+package wol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	serverPkg "golem/server"
+)
+
+// A WolServer implements server.Server by wrapping the manager of a server on
+// a host that sleeps while the server is stopped. Starts wake the host with a
+// Wake-on-LAN magic packet and wait until it is reachable, and idle stops can
+// suspend it with a shell command. The optional interfaces of the inner
+// manager are forwarded, where a PausingWolServer forwards server.Pauser.
+type WolServer struct {
+	inner   serverPkg.Server
+	states  *serverPkg.StateMachine
+	logger  *log.Logger
+	options Options
+
+	cancelFollow func() // ends following the inner manager
+
+	mu         sync.Mutex    // guards state changes and fields below
+	woken      chan struct{} // closed when the wake is done, nil if not waking
+	cancelWake context.CancelFunc
+}
+
+// Options are the options of a WolServer.
+type Options struct {
+	// MAC is the hardware address of the host, woken by sending the magic
+	// packet to the UDP address Broadcast
+	MAC       net.HardwareAddr
+	Broadcast string
+
+	// Host is a TCP address of the host that accepts connections once it is
+	// awake, checked every Interval for at most Timeout
+	Host     string
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// SuspendCommand is an optional shell command run after idle stops,
+	// such as ssh to the host to suspend it
+	SuspendCommand string
+}
+
+// A PausingWolServer is a WolServer whose inner manager is a server.Pauser,
+// which it forwards.
+type PausingWolServer struct {
+	*WolServer
+	pauser serverPkg.Pauser
+}
+
+// NewWolServer returns a new WolServer wrapping a server manager, or a
+// PausingWolServer if the manager is a server.Pauser.
+func NewWolServer(
+	logger *log.Logger,
+	inner serverPkg.Server,
+	options Options,
+) serverPkg.Server {
+
+	// Subscribe before checking the state to not miss changes
+	events, cancel := inner.Subscribe()
+
+	s := WolServer{}
+	s.inner = inner
+	s.states = serverPkg.NewStateMachine(inner.State())
+	s.logger = logger
+	s.options = options
+	s.cancelFollow = cancel
+	go s.follow(events)
+
+	if pauser, ok := inner.(serverPkg.Pauser); ok {
+		return &PausingWolServer{&s, pauser}
+	}
+	return &s
+
+}
+
+// Start implements server.Server by waking the host, then starting the inner
+// manager. The server is starting while the host wakes.
+func (s *WolServer) Start() error {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.states.Transition(
+		serverPkg.Stopped,
+		serverPkg.Starting,
+		"start requested",
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		s.options.Timeout,
+	)
+	s.woken = make(chan struct{})
+	s.cancelWake = cancel
+	go s.wake(ctx)
+
+	return nil
+
+}
+
+// wake wakes the host and starts the inner manager, which may need to
+// connect to the host first, until ctx is done.
+func (s *WolServer) wake(ctx context.Context) {
+
+	err := func() error {
+
+		// Send the packet every interval until the host is reachable
+		reachable := s.reachable()
+		if !reachable {
+			s.logger.Printf("waking host %s\n", s.options.MAC)
+		}
+		for !reachable {
+			err := s.sendMagicPacket()
+			if err != nil {
+				return err
+			}
+			select {
+			case <-time.After(s.options.Interval):
+			case <-ctx.Done():
+				return fmt.Errorf("host not reachable: %s", ctx.Err())
+			}
+			reachable = s.reachable()
+		}
+
+		// Start once the inner manager is ready
+		for {
+			err := s.inner.Start()
+			if err == nil || errors.Is(err, serverPkg.ErrNotStopped) {
+				return nil
+			}
+			select {
+			case <-time.After(s.options.Interval):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+	}()
+	if err != nil {
+		s.logger.Printf("error waking host: %s\n", err)
+	}
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelWake()
+	close(s.woken)
+	s.woken = nil
+	if err != nil {
+		reason := fmt.Sprintf("wake failed: %s", err)
+		s.states.Follow(serverPkg.Stopped, reason)
+		return
+	}
+	s.states.Follow(s.inner.State(), "host awake")
+
+}
+
+// Stop implements server.Server by stopping the inner manager, canceling a
+// wake first, and changes the state before returning. The host is left
+// awake.
+func (s *WolServer) Stop() error {
+
+	// Wait for a canceled wake
+	s.mu.Lock()
+	woken := s.woken
+	if woken != nil {
+		s.cancelWake()
+	}
+	s.mu.Unlock()
+	if woken != nil {
+		<-woken
+	}
+
+	err := s.inner.Stop()
+	s.update(s.inner.State(), "server stopped")
+	if woken != nil && errors.Is(err, serverPkg.ErrStopped) {
+		err = nil
+	}
+	return err
+
+}
+
+// StopIdle implements server.IdleStopper by stopping, then running the
+// suspend command.
+func (s *WolServer) StopIdle() error {
+
+	err := s.Stop()
+	if err != nil {
+		return err
+	}
+
+	if s.options.SuspendCommand != "" {
+		err := s.run(s.options.SuspendCommand)
+		if err != nil {
+			s.logger.Printf("error suspending host: %s\n", err)
+		}
+	}
+
+	return nil
+
+}
+
+// Execute implements server.Server by executing on the inner manager.
+func (s *WolServer) Execute(
+	ctx context.Context,
+	command string,
+) (string, error) {
+	return s.inner.Execute(ctx, command)
+}
+
+// State implements server.Server.
+func (s *WolServer) State() serverPkg.ServerState {
+	return s.states.State()
+}
+
+// Subscribe implements server.Server.
+func (s *WolServer) Subscribe() (<-chan serverPkg.StateEvent, func()) {
+	return s.states.Subscribe()
+}
+
+// Uptime implements server.Uptimer if the inner manager does.
+func (s *WolServer) Uptime() time.Duration {
+	if uptimer, ok := s.inner.(serverPkg.Uptimer); ok {
+		return uptimer.Uptime()
+	}
+	return 0
+}
+
+// Detached implements server.Detacher if the inner manager does.
+func (s *WolServer) Detached() bool {
+	detacher, ok := s.inner.(serverPkg.Detacher)
+	return ok && detacher.Detached()
+}
+
+// Pause implements server.Pauser, changing the state before returning.
+func (s *PausingWolServer) Pause() error {
+	err := s.pauser.Pause()
+	s.update(s.inner.State(), "paused")
+	return err
+}
+
+// Resume implements server.Pauser, changing the state before returning.
+func (s *PausingWolServer) Resume() error {
+	err := s.pauser.Resume()
+	s.update(s.inner.State(), "resumed")
+	return err
+}
+
+// StartupProgress implements server.StartupReporter if the inner manager
+// does, which is not starting while the host wakes.
+func (s *WolServer) StartupProgress() (serverPkg.StartupProgress, bool) {
+	reporter, ok := s.inner.(serverPkg.StartupReporter)
+	if !ok {
+		return serverPkg.StartupProgress{}, false
+	}
+	return reporter.StartupProgress()
+}
+
+// LastCrash implements server.CrashReporter if the inner manager does.
+func (s *WolServer) LastCrash() (serverPkg.Crash, bool) {
+	reporter, ok := s.inner.(serverPkg.CrashReporter)
+	if !ok {
+		return serverPkg.Crash{}, false
+	}
+	return reporter.LastCrash()
+}
+
+// Close implements server.Closer by ending following the inner manager, and
+// closing it if it is a server.Closer.
+func (s *WolServer) Close() error {
+	s.cancelFollow()
+	if closer, ok := s.inner.(serverPkg.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// follow follows the state of the inner manager from its events, except
+// that it stays starting while the host wakes. Events only trigger updates
+// to the current state, so late events do not undo updates by Pause and
+// Resume.
+func (s *WolServer) follow(events <-chan serverPkg.StateEvent) {
+	for event := range events {
+		s.update(s.inner.State(), event.Reason)
+	}
+}
+
+// update changes the state to a state of the inner manager, unless it is
+// stopped while the host wakes.
+func (s *WolServer) update(state serverPkg.ServerState, reason string) {
+
+	// State changes hold mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.woken == nil || state != serverPkg.Stopped {
+		s.states.Follow(state, reason)
+	}
+
+}
+
+// reachable returns if the host accepts connections.
+func (s *WolServer) reachable() bool {
+	conn, err := net.DialTimeout("tcp", s.options.Host, s.options.Interval)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// sendMagicPacket broadcasts the Wake-on-LAN magic packet of the host: 6
+// bytes 0xff, then the hardware address 16 times.
+func (s *WolServer) sendMagicPacket() error {
+
+	packet := make([]byte, 6, 6+16*len(s.options.MAC))
+	for i := range packet {
+		packet[i] = 0xff
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, s.options.MAC...)
+	}
+
+	conn, err := net.Dial("udp", s.options.Broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(packet)
+	return err
+
+}
+
+// run runs a shell command, logging its output.
+func (s *WolServer) run(command string) error {
+
+	s.logger.Printf("running command: %s\n", command)
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			s.logger.Printf("[%s] %s\n", command, line)
+		}
+	}
+	return err
+
+}
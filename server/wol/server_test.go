@@ -0,0 +1,160 @@
+package wol
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	serverPkg "golem/server"
+	"golem/server/servertest"
+)
+
+// A fakeServer is a servertest.PausingServer that reports startup progress
+// and crashes.
+type fakeServer struct {
+	*servertest.PausingServer
+}
+
+func (s *fakeServer) StartupProgress() (serverPkg.StartupProgress, bool) {
+	return serverPkg.StartupProgress{Percent: 42}, true
+}
+
+func (s *fakeServer) LastCrash() (serverPkg.Crash, bool) {
+	return serverPkg.Crash{Reason: "out of memory"}, true
+}
+
+// newTestServer returns a new WolServer wrapping a server manager on a host
+// that is awake, running a suspend command that creates a file, closed when
+// the test ends.
+func newTestServer(
+	t *testing.T,
+	inner serverPkg.Server,
+	suspended string,
+) serverPkg.Server {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	mac, _ := net.ParseMAC("0a:1b:2c:3d:4e:5f")
+	s := NewWolServer(
+		log.New(io.Discard, "", 0),
+		inner,
+		Options{
+			MAC:            mac,
+			Broadcast:      "127.0.0.1:9",
+			Host:           listener.Addr().String(),
+			Interval:       10 * time.Millisecond,
+			Timeout:        5 * time.Second,
+			SuspendCommand: "echo suspended > " + suspended,
+		},
+	)
+	t.Cleanup(func() { s.(serverPkg.Closer).Close() })
+	return s
+
+}
+
+func TestForwarded(t *testing.T) {
+
+	inner := &fakeServer{servertest.NewPausingServer(serverPkg.Stopped)}
+	s := newTestServer(t, inner, filepath.Join(t.TempDir(), "suspended"))
+
+	progress, ok := s.(serverPkg.StartupReporter).StartupProgress()
+	if !ok || progress.Percent != 42 {
+		t.Errorf("startup progress: got %+v, %t", progress, ok)
+	}
+	crash, ok := s.(serverPkg.CrashReporter).LastCrash()
+	if !ok || crash.Reason != "out of memory" {
+		t.Errorf("last crash: got %+v, %t", crash, ok)
+	}
+
+	// Pauses change the state before returning
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	pauser := s.(serverPkg.Pauser)
+	err = pauser.Pause()
+	if err != nil || s.State() != serverPkg.Paused {
+		t.Errorf("pause: got %s, %v", s.State(), err)
+	}
+	err = pauser.Resume()
+	if err != nil || s.State() != serverPkg.Running {
+		t.Errorf("resume: got %s, %v", s.State(), err)
+	}
+
+}
+
+func TestNotPausing(t *testing.T) {
+
+	// Managers that can not pause are not paused by routes
+	inner := servertest.NewServer(serverPkg.Stopped)
+	s := newTestServer(t, inner, filepath.Join(t.TempDir(), "suspended"))
+	if _, ok := s.(serverPkg.Pauser); ok {
+		t.Error("server of a manager that can not pause is a Pauser")
+	}
+
+}
+
+func TestClose(t *testing.T) {
+
+	inner := servertest.NewServer(serverPkg.Stopped)
+	s := newTestServer(t, inner, filepath.Join(t.TempDir(), "suspended"))
+	err := s.(serverPkg.Closer).Close()
+	if err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if !inner.Closed() {
+		t.Error("inner manager not closed")
+	}
+
+	// The state of the inner manager is no longer followed
+	inner.Start()
+	time.Sleep(50 * time.Millisecond)
+	if state := s.State(); state != serverPkg.Stopped {
+		t.Errorf("closed server is %s", state)
+	}
+
+}
+
+func TestSuspendOnIdleStop(t *testing.T) {
+
+	suspended := filepath.Join(t.TempDir(), "suspended")
+	inner := servertest.NewServer(serverPkg.Stopped)
+	s := newTestServer(t, inner, suspended)
+
+	// Other stops leave the host awake
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	if _, err := os.Stat(suspended); !os.IsNotExist(err) {
+		t.Error("host suspended after stop")
+	}
+
+	err = s.Start()
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+	servertest.Wait(t, s, serverPkg.Running)
+	err = s.(serverPkg.IdleStopper).StopIdle()
+	if err != nil {
+		t.Fatalf("idle stop: %s", err)
+	}
+	if _, err := os.Stat(suspended); err != nil {
+		t.Errorf("host not suspended after idle stop: %s", err)
+	}
+
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golem/config"
+	proxyPkg "golem/proxy"
+	serverPkg "golem/server"
+	"golem/server/docker"
+	"golem/server/kubernetes"
+	"golem/server/process"
+	"golem/server/rcon"
+	"golem/server/remote"
+	"golem/server/wol"
+)
+
+// newServer makes a server manager from its config, waking its host with
+// Wake-on-LAN if configured.
+func newServer(name string, c *config.Server) serverPkg.Server {
+
+	server := newManager(name, c)
+	if c.Manager.Wol.MAC == "" {
+		return server
+	}
+
+	mac, _ := net.ParseMAC(c.Manager.Wol.MAC)
+	return wol.NewWolServer(
+		newLogger(loggerPrefix("wol", name)),
+		server,
+		wol.Options{
+			MAC:            mac,
+			Broadcast:      c.Manager.Wol.Broadcast,
+			Host:           c.Manager.Wol.Host,
+			Interval:       c.Manager.Wol.Interval.Duration(),
+			Timeout:        c.Manager.Wol.Timeout.Duration(),
+			SuspendCommand: c.Manager.Wol.Suspend,
+		},
+	)
+
+}
+
+// newManager makes the server manager of a type from its config.
+func newManager(name string, c *config.Server) serverPkg.Server {
+	switch c.Manager.Type {
+	case config.ManagerProcess:
+		return process.NewProcessServer(
+			newLogger(loggerPrefix("server", name)),
+			strings.Fields(c.Manager.Start),
+			c.Manager.Directory,
+			process.Options{
+				Ready:        newReadiness(c),
+				StartTimeout: c.Manager.StartTimeout.Duration(),
+				Stop: process.StopSequence{
+					Save:        c.Manager.Stop.Save,
+					SaveTimeout: c.Manager.Stop.SaveTimeout.Duration(),
+					Timeout:     c.Manager.Stop.Timeout.Duration(),
+					TermTimeout: c.Manager.Stop.TermTimeout.Duration(),
+					Deadline:    c.Manager.Stop.Deadline.Duration(),
+				},
+				Restart: process.RestartPolicy{
+					OnCrash:     c.Manager.Restart.OnCrash,
+					Backoff:     c.Manager.Restart.Backoff.Duration(),
+					MaxBackoff:  c.Manager.Restart.MaxBackoff.Duration(),
+					MaxAttempts: c.Manager.Restart.MaxAttempts,
+					ResetAfter:  c.Manager.Restart.ResetAfter.Duration(),
+				},
+				Detach: c.Manager.Detach,
+			},
+		)
+	case config.ManagerRcon:
+		return rcon.NewRconServer(
+			newLogger(loggerPrefix("server", name)),
+			rcon.Options{
+				Addr:            c.Manager.Rcon.Addr,
+				Password:        c.Manager.Rcon.Password,
+				ServerAddr:      c.Addr,
+				ProtocolVersion: c.Status.VersionProtocol,
+				Interval:        c.Manager.Rcon.Interval.Duration(),
+				StartCommand:    c.Manager.Start,
+				StopCommand:     c.Manager.Rcon.Stop,
+				Directory:       c.Manager.Directory,
+				StartTimeout:    c.Manager.StartTimeout.Duration(),
+				StopTimeout:     c.Manager.Stop.Deadline.Duration(),
+			},
+		)
+	case config.ManagerDocker:
+
+		// Execute over RCON if it has a password, otherwise through stdin
+		var conn *rcon.Conn
+		if c.Manager.Rcon.Password != "" {
+			conn = rcon.NewConn(c.Manager.Rcon.Addr, c.Manager.Rcon.Password)
+		}
+
+		return docker.NewDockerServer(
+			newLogger(loggerPrefix("server", name)),
+			docker.Options{
+				Socket:          c.Manager.Docker.Socket,
+				Container:       c.Manager.Docker.Container,
+				Interval:        c.Manager.Docker.Interval.Duration(),
+				ServerAddr:      c.Addr,
+				ProtocolVersion: c.Status.VersionProtocol,
+				Rcon:            conn,
+				Save:            c.Manager.Stop.Save,
+				SaveTimeout:     c.Manager.Stop.SaveTimeout.Duration(),
+				StopTimeout:     c.Manager.Stop.Timeout.Duration(),
+			},
+		)
+	case config.ManagerKubernetes:
+		return kubernetes.NewKubernetesServer(
+			newLogger(loggerPrefix("server", name)),
+			kubernetes.Options{
+				API:         c.Manager.Kubernetes.API,
+				TokenFile:   c.Manager.Kubernetes.TokenFile,
+				CAFile:      c.Manager.Kubernetes.CAFile,
+				Namespace:   c.Manager.Kubernetes.Namespace,
+				StatefulSet: c.Manager.Kubernetes.StatefulSet,
+				Interval:    c.Manager.Kubernetes.Interval.Duration(),
+				Rcon: rcon.NewConn(
+					c.Manager.Rcon.Addr,
+					c.Manager.Rcon.Password,
+				),
+				StopTimeout: c.Manager.Stop.Deadline.Duration(),
+			},
+		)
+	case config.ManagerRemote:
+
+		// The agent uses the same server name by default
+		server := c.Manager.Remote.Server
+		if server == "" {
+			server = name
+		}
+
+		return remote.NewRemoteServer(
+			newLogger(loggerPrefix("server", name)),
+			remote.Options{
+				Addr:          c.Manager.Remote.Addr,
+				Token:         c.Manager.Remote.Token,
+				Server:        server,
+				RetryInterval: c.Manager.Remote.Interval.Duration(),
+			},
+		)
+	}
+	return serverPkg.NewBasicServer()
+}
+
+// newReadiness makes the readiness of a process server from its config.
+func newReadiness(c *config.Server) process.Readiness {
+	r := process.Readiness{}
+	r.Strategy = c.Manager.Ready.Type
+	r.Addr = c.Addr
+	r.Interval = c.Manager.Ready.Interval.Duration()
+	r.ProtocolVersion = c.Status.VersionProtocol
+	if r.Strategy == config.ReadyConsole {
+		r.Pattern = regexp.MustCompile(c.Manager.Ready.Pattern)
+	}
+	return r
+}
+
+// newRoute makes a route to a server from its config.
+func newRoute(
+	name string,
+	c *config.Server,
+	server serverPkg.Server,
+) *proxyPkg.Route {
+
+	// Make stop duration reference if autostart/stop is enabled, which
+	// needs a start command for rcon servers
+	var stopDuration *time.Duration
+	if c.Manager.Type != config.ManagerBasic &&
+		(c.Manager.Type != config.ManagerRcon || c.Manager.Start != "") {
+		d := c.Idle.StopTimeout.Duration()
+		stopDuration = &d
+	}
+
+	// Save the last known status and load the favicon in the server
+	// directory by default
+	lastStatusFile := c.Status.LastKnownFile
+	if lastStatusFile == "" && c.Manager.Directory != "" {
+		lastStatusFile = filepath.Join(c.Manager.Directory, "golem-status.json")
+	}
+	faviconFile := c.Status.Favicon
+	if faviconFile == "" && c.Manager.Directory != "" {
+		faviconFile = filepath.Join(c.Manager.Directory, "server-icon.png")
+	}
+
+	return proxyPkg.NewRoute(
+		newLogger(loggerPrefix("proxy", name)),
+		server,
+		proxyPkg.RouteOptions{
+			Name:                name,
+			ServerAddr:          c.Addr,
+			StopDuration:        stopDuration,
+			PauseDuration:       c.Idle.PauseTimeout.Duration(),
+			Messages:            proxyPkg.Messages(c.Messages),
+			MOTD:                c.Status.MOTD,
+			VersionName:         c.Status.VersionName,
+			VersionProtocol:     c.Status.VersionProtocol,
+			PlayersMax:          c.Status.PlayersMax,
+			ForwardStatus:       c.Status.Forward,
+			StatusCacheDuration: c.Status.CacheDuration.Duration(),
+			LastStatus:          c.Status.LastKnown,
+			LastStatusFile:      lastStatusFile,
+			SleepingSuffix:      c.Status.SleepingSuffix,
+			StartingSuffix:      c.Status.StartingSuffix,
+			FaviconFile:         faviconFile,
+			HoldLogin:           c.Login.Hold,
+			HoldTimeout:         c.Login.HoldTimeout.Duration(),
+			Limbo:               c.Login.Limbo,
+			LimboTimeout:        c.Login.LimboTimeout.Duration(),
+			PlayerSampleMax:     c.Status.PlayerSample,
+			HidePlayerNames:     c.Status.HidePlayerNames,
+		},
+	)
+
+}
+
+// loggerPrefix returns a logger prefix for a named server, keeping the
+// unnamed prefix for the default server.
+func loggerPrefix(kind string, name string) string {
+	if name == config.DefaultServerName {
+		return "[" + kind + "] "
+	}
+	return "[" + kind + " " + name + "] "
+}